@@ -0,0 +1,77 @@
+package account_test
+
+import (
+	"github.com/ramk42/omi-backend-assignment/internal/account"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestAccount_Normalize(t *testing.T) {
+	acc := account.Account{Name: "  Jane \t  Doe ", Email: "  Jane.Doe@Example.COM "}
+	acc.Normalize()
+
+	assert.Equal(t, "Jane Doe", acc.Name)
+	assert.Equal(t, "jane.doe@example.com", acc.Email)
+}
+
+func TestPatch_Normalize(t *testing.T) {
+	email := " JANE@example.com"
+	patch := account.Patch{Email: &email}
+	patch.Normalize()
+
+	assert.Nil(t, patch.Name)
+	require.NotNil(t, patch.Email)
+	assert.Equal(t, "jane@example.com", *patch.Email)
+	assert.Equal(t, " JANE@example.com", email, "the caller's value must not be rewritten")
+}
+
+func TestAccount_Validate(t *testing.T) {
+	longLocal := strings.Repeat("a", 65)
+	tests := map[string]struct {
+		name, email string
+		// fields maps each rejected field to its message
+		fields map[string]string
+	}{
+		"valid":                   {name: "Jane Doe", email: "jane@example.com"},
+		"name at the limit":       {name: strings.Repeat("é", account.MaxNameLength), email: "jane@example.com"},
+		"local part at the limit": {name: "Jane", email: strings.Repeat("a", 64) + "@example.com"},
+		"missing fields": {fields: map[string]string{
+			"name": "is required", "email": "is required"}},
+		"name too long": {name: strings.Repeat("é", account.MaxNameLength+1), email: "jane@example.com",
+			fields: map[string]string{"name": "must be at most 100 characters"}},
+		"name with control character": {name: "Jane\x00Doe", email: "jane@example.com",
+			fields: map[string]string{"name": "must not contain control characters"}},
+		"email too long": {name: "Jane", email: strings.Repeat("a", 64) + "@" + strings.Repeat("b", 186) + ".com",
+			fields: map[string]string{"email": "must be at most 254 characters"}},
+		"local part too long": {name: "Jane", email: longLocal + "@example.com",
+			fields: map[string]string{"email": "local part must be at most 64 characters"}},
+		"display name form": {name: "Jane", email: "Jane <jane@example.com>",
+			fields: map[string]string{"email": "must be a valid email address"}},
+		"missing at sign": {name: "Jane", email: "jane.example.com",
+			fields: map[string]string{"email": "must be a valid email address"}},
+		"domain without dot": {name: "Jane", email: "jane@localhost",
+			fields: map[string]string{"email": "must be a valid email address"}},
+		"domain with trailing dot": {name: "Jane", email: "jane@example.com.",
+			fields: map[string]string{"email": "must be a valid email address"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			acc := account.Account{Name: tt.name, Email: tt.email}
+			err := acc.Validate()
+			if len(tt.fields) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *account.ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			got := map[string]string{}
+			for _, fe := range validationErr.Errors {
+				got[fe.Field] = fe.Message
+			}
+			assert.Equal(t, tt.fields, got)
+		})
+	}
+}
@@ -2,44 +2,220 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/ramk42/omi-backend-assignment/internal/account"
 	"github.com/ramk42/omi-backend-assignment/internal/account/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/rs/zerolog/log"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// maxPatchBodySize bounds the body of a patch, as the audit middleware bounds
+// the body it captures.
+const maxPatchBodySize = 64 << 10
+
 type AccountHandler struct {
 	accountUsecase usecase.AccountPort
 }
 
-type AccountPatchReq struct {
+func NewAccountHandler(accountUsecase usecase.AccountPort) *AccountHandler {
+	return &AccountHandler{accountUsecase: accountUsecase}
+}
+
+type AccountCreateReq struct {
 	Name  string `json:"name"`
 	Email string `json:"email"`
 }
 
+type AccountResp struct {
+	ID        string    `json:"id"`
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type AccountListResp struct {
+	Data       []AccountResp `json:"data"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+func toAccountResp(acc account.Account) AccountResp {
+	return AccountResp{
+		ID:        acc.ID,
+		Version:   acc.Version,
+		Name:      acc.Name,
+		Email:     acc.Email,
+		CreatedAt: acc.CreatedAt,
+		UpdatedAt: acc.UpdatedAt,
+	}
+}
+
+func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req AccountCreateReq
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		logsreporting.FlagSecurity(r.Context(), logsreporting.ReasonMalformedPayload, err.Error(), auditActor(r.Context()))
+		writeProblem(w, newProblem(r, http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	created, err := h.accountUsecase.Create(r.Context(), account.Account{
+		Name:  req.Name,
+		Email: req.Email,
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/accounts/"+created.ID)
+	w.Header().Set("ETag", formatETag(created.Version))
+	writeJSON(w, http.StatusCreated, toAccountResp(*created))
+}
+
+func (h *AccountHandler) Get(w http.ResponseWriter, r *http.Request) {
+	acc, err := h.accountUsecase.Get(r.Context(), chi.URLParam(r, "resourceID"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(acc.Version))
+	writeJSON(w, http.StatusOK, toAccountResp(*acc))
+}
+
+func (h *AccountHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := account.ListFilter{
+		Name:   query.Get("name"),
+		Email:  query.Get("email"),
+		Cursor: query.Get("cursor"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			writeProblem(w, newProblem(r, http.StatusBadRequest, "limit must be an integer"))
+			return
+		}
+	}
+
+	page, err := h.accountUsecase.List(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	resp := AccountListResp{Data: make([]AccountResp, 0, len(page.Accounts)), NextCursor: page.NextCursor}
+	for _, acc := range page.Accounts {
+		resp.Data = append(resp.Data, toAccountResp(acc))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Patch accepts either an RFC 7396 merge patch or an RFC 6902 JSON patch and
+// responds with the updated account.
 func (h *AccountHandler) Patch(w http.ResponseWriter, r *http.Request) {
 	accountID := chi.URLParam(r, "resourceID")
 	if accountID == "" {
-		http.Error(w, "accountID is required", http.StatusBadRequest)
+		writeProblem(w, newProblem(r, http.StatusBadRequest, "accountID is required"))
 		return
 	}
 
-	var req AccountPatchReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeProblem(w, newProblem(r, http.StatusRequestEntityTooLarge,
+				"the patch must be at most "+strconv.FormatInt(maxBytesErr.Limit, 10)+" bytes"))
+			return
+		}
+		writeProblem(w, newProblem(r, http.StatusBadRequest, err.Error()))
+		return
+	}
+	patch, err := decodePatch(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if patch.Version, err = parseIfMatch(r.Header.Get("If-Match")); err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
-	err := h.accountUsecase.Patch(r.Context(), account.Account{
-		ID:    accountID,
-		Name:  req.Name,
-		Email: req.Email,
-	})
+	mutation, err := h.accountUsecase.Patch(r.Context(), accountID, patch)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(mutation.After.Version))
+	writeJSON(w, http.StatusOK, toAccountResp(mutation.After))
+}
 
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	_, err = h.accountUsecase.Delete(r.Context(), chi.URLParam(r, "resourceID"), expectedVersion)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		h.writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
-	return
+}
+
+func (h *AccountHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *account.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		problem := newProblem(r, http.StatusUnprocessableEntity, "the account has invalid fields")
+		problem.Type = problemTypeValidation
+		problem.Title = "Validation failed"
+		for _, fe := range validationErr.Errors {
+			problem.Errors = append(problem.Errors, ProblemFieldError{Field: fe.Field, Message: fe.Message})
+		}
+		writeProblem(w, problem)
+	case errors.Is(err, account.ErrEmailTaken):
+		problem := newProblem(r, http.StatusConflict, err.Error())
+		problem.Errors = []ProblemFieldError{{Field: "email", Message: "is already in use"}}
+		writeProblem(w, problem)
+	case errors.Is(err, account.ErrVersionMismatch):
+		writeProblem(w, newProblem(r, http.StatusPreconditionFailed, err.Error()))
+	case errors.Is(err, errMalformedPatch):
+		logsreporting.FlagSecurity(r.Context(), logsreporting.ReasonMalformedPayload, err.Error(), auditActor(r.Context()))
+		writeProblem(w, newProblem(r, http.StatusBadRequest, err.Error()))
+	case errors.Is(err, account.ErrInvalidAccountID), errors.Is(err, account.ErrInvalidCursor), errors.Is(err, errInvalidIfMatch):
+		writeProblem(w, newProblem(r, http.StatusBadRequest, err.Error()))
+	case errors.Is(err, account.ErrAccountNotFound):
+		writeProblem(w, newProblem(r, http.StatusNotFound, err.Error()))
+	case errors.Is(err, errUnsupportedPatch):
+		w.Header().Set("Accept-Patch", contentTypeMergePatch+", "+contentTypeJSONPatch)
+		writeProblem(w, newProblem(r, http.StatusUnsupportedMediaType, err.Error()))
+	case errors.Is(err, account.ErrPatchTestFailed):
+		writeProblem(w, newProblem(r, http.StatusConflict, err.Error()))
+	case errors.Is(err, errInvalidPatch):
+		writeProblem(w, newProblem(r, http.StatusUnprocessableEntity, err.Error()))
+	case errors.Is(err, logsreporting.ErrAuditUnavailable):
+		log.Ctx(r.Context()).Error().Err(err).Msg("account operation rejected, it cannot be audited")
+		writeProblem(w, newProblem(r, http.StatusServiceUnavailable, logsreporting.ErrAuditUnavailable.Error()))
+	default:
+		log.Ctx(r.Context()).Error().Err(err).Str("method", r.Method).Str("path", r.URL.Path).Msg("account operation failed")
+		writeProblem(w, newProblem(r, http.StatusInternalServerError, ""))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error().Err(err).Msg("failed to write response body")
+	}
 }
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ramk42/omi-backend-assignment/internal/account"
+	"mime"
+	"strings"
+)
+
+const (
+	contentTypeJSON       = "application/json"
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	errMalformedPatch   = errors.New("malformed patch document")
+	errInvalidPatch     = errors.New("invalid patch document")
+	errUnsupportedPatch = errors.New("unsupported patch media type")
+)
+
+// patchableFields lists the account fields a client may modify, by JSON name.
+var patchableFields = map[string]func(p *account.Patch) **string{
+	"name":  func(p *account.Patch) **string { return &p.Name },
+	"email": func(p *account.Patch) **string { return &p.Email },
+}
+
+// decodePatch turns a PATCH body into an account.Patch according to its media type.
+// Plain application/json is treated as a merge patch for backward compatibility.
+func decodePatch(contentType string, body []byte) (account.Patch, error) {
+	mediaType := contentTypeJSON
+	if contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return account.Patch{}, errUnsupportedPatch
+		}
+	}
+
+	switch mediaType {
+	case contentTypeJSON, contentTypeMergePatch:
+		return decodeMergePatch(body)
+	case contentTypeJSONPatch:
+		return decodeJSONPatch(body)
+	default:
+		return account.Patch{}, errUnsupportedPatch
+	}
+}
+
+// decodeMergePatch implements RFC 7396: an omitted member is left untouched, a
+// null member removes the field and any other value replaces it.
+func decodeMergePatch(body []byte) (account.Patch, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return account.Patch{}, fmt.Errorf("%w: body must be a JSON object", errMalformedPatch)
+	}
+
+	var patch account.Patch
+	for member, raw := range doc {
+		field, ok := patchableFields[member]
+		if !ok {
+			return account.Patch{}, fmt.Errorf("%w: unknown field %q", errInvalidPatch, member)
+		}
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			return account.Patch{}, fmt.Errorf("%w: field %q is required and cannot be removed", errInvalidPatch, member)
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return account.Patch{}, fmt.Errorf("%w: field %q must be a string", errMalformedPatch, member)
+		}
+		*field(&patch) = &value
+	}
+	return patch, nil
+}
+
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// decodeJSONPatch implements the subset of RFC 6902 that makes sense for a flat
+// resource: "add" and "replace" set a field, "test" asserts its current value.
+func decodeJSONPatch(body []byte) (account.Patch, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return account.Patch{}, fmt.Errorf("%w: body must be an array of operations", errMalformedPatch)
+	}
+
+	var patch account.Patch
+	for i, op := range ops {
+		member := strings.TrimPrefix(op.Path, "/")
+		field, ok := patchableFields[member]
+		if !ok || !strings.HasPrefix(op.Path, "/") {
+			return account.Patch{}, fmt.Errorf("%w: operation %d targets unknown path %q", errInvalidPatch, i, op.Path)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return account.Patch{}, fmt.Errorf("%w: operation %d is missing a value", errMalformedPatch, i)
+			}
+			var value string
+			if err := json.Unmarshal(*op.Value, &value); err != nil {
+				return account.Patch{}, fmt.Errorf("%w: operation %d value must be a string", errMalformedPatch, i)
+			}
+
+			if op.Op != "test" {
+				*field(&patch) = &value
+				continue
+			}
+			// a test following a change of the same field is checked against the patched value
+			if current := *field(&patch); current != nil {
+				if *current != value {
+					return account.Patch{}, account.ErrPatchTestFailed
+				}
+				continue
+			}
+			if patch.Expected == nil {
+				patch.Expected = map[string]string{}
+			}
+			patch.Expected[member] = value
+		case "remove":
+			return account.Patch{}, fmt.Errorf("%w: field %q is required and cannot be removed", errInvalidPatch, member)
+		default:
+			return account.Patch{}, fmt.Errorf("%w: operation %d has unsupported op %q", errInvalidPatch, i, op.Op)
+		}
+	}
+	return patch, nil
+}
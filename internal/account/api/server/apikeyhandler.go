@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/ramk42/omi-backend-assignment/internal/apikey"
+	"github.com/ramk42/omi-backend-assignment/internal/apikey/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+// defaultRotationGracePeriod is how long the previous secret of a rotated key stays valid by default.
+const defaultRotationGracePeriod = 24 * time.Hour
+
+type APIKeyHandler struct {
+	apiKeyUsecase usecase.APIKeyPort
+}
+
+type APIKeyIssueReq struct {
+	Service string   `json:"service"`
+	Tenant  string   `json:"tenant"`
+	Scopes  []string `json:"scopes"`
+}
+
+type APIKeyRotateReq struct {
+	GracePeriodSec *int `json:"grace_period_sec"`
+}
+
+type APIKeyResp struct {
+	ID                      string     `json:"id"`
+	Service                 string     `json:"service"`
+	Tenant                  string     `json:"tenant,omitempty"`
+	Scopes                  []string   `json:"scopes"`
+	CreatedAt               time.Time  `json:"created_at"`
+	RotatedAt               *time.Time `json:"rotated_at,omitempty"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	RevokedAt               *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyIssuedResp is the only response exposing the token of a key.
+type APIKeyIssuedResp struct {
+	APIKeyResp
+	Token string `json:"token"`
+}
+
+func toAPIKeyResp(key apikey.APIKey) APIKeyResp {
+	return APIKeyResp{
+		ID:                      key.ID,
+		Service:                 key.Service,
+		Tenant:                  key.Tenant,
+		Scopes:                  key.Scopes,
+		CreatedAt:               key.CreatedAt,
+		RotatedAt:               key.RotatedAt,
+		PreviousSecretExpiresAt: key.PreviousSecretExpiresAt,
+		RevokedAt:               key.RevokedAt,
+	}
+}
+
+func (h *APIKeyHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyIssueReq
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		logsreporting.FlagSecurity(r.Context(), logsreporting.ReasonMalformedPayload, err.Error(), auditActor(r.Context()))
+		writeProblem(w, newProblem(r, http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	issued, err := h.apiKeyUsecase.Issue(r.Context(), req.Service, req.Tenant, req.Scopes)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, APIKeyIssuedResp{APIKeyResp: toAPIKeyResp(issued.Key), Token: issued.Token})
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeyUsecase.List(r.Context())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	resp := make([]APIKeyResp, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, toAPIKeyResp(key))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *APIKeyHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	gracePeriod := defaultRotationGracePeriod
+	if r.ContentLength != 0 {
+		var req APIKeyRotateReq
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			logsreporting.FlagSecurity(r.Context(), logsreporting.ReasonMalformedPayload, err.Error(), auditActor(r.Context()))
+			writeProblem(w, newProblem(r, http.StatusBadRequest, err.Error()))
+			return
+		}
+		if req.GracePeriodSec != nil {
+			if *req.GracePeriodSec < 0 {
+				writeProblem(w, newProblem(r, http.StatusBadRequest, "grace_period_sec must not be negative"))
+				return
+			}
+			gracePeriod = time.Duration(*req.GracePeriodSec) * time.Second
+		}
+	}
+
+	issued, err := h.apiKeyUsecase.Rotate(r.Context(), chi.URLParam(r, "resourceID"), gracePeriod)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, APIKeyIssuedResp{APIKeyResp: toAPIKeyResp(issued.Key), Token: issued.Token})
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := h.apiKeyUsecase.Revoke(r.Context(), chi.URLParam(r, "resourceID")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *APIKeyHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, apikey.ErrServiceRequired):
+		problem := newProblem(r, http.StatusUnprocessableEntity, err.Error())
+		problem.Errors = []ProblemFieldError{{Field: "service", Message: "is required"}}
+		writeProblem(w, problem)
+	case errors.Is(err, apikey.ErrAPIKeyNotFound):
+		writeProblem(w, newProblem(r, http.StatusNotFound, err.Error()))
+	case errors.Is(err, apikey.ErrAPIKeyRevoked):
+		writeProblem(w, newProblem(r, http.StatusConflict, err.Error()))
+	case errors.Is(err, logsreporting.ErrAuditUnavailable):
+		log.Ctx(r.Context()).Error().Err(err).Msg("api key operation rejected, it cannot be audited")
+		writeProblem(w, newProblem(r, http.StatusServiceUnavailable, logsreporting.ErrAuditUnavailable.Error()))
+	default:
+		log.Ctx(r.Context()).Error().Err(err).Str("method", r.Method).Str("path", r.URL.Path).Msg("api key operation failed")
+		writeProblem(w, newProblem(r, http.StatusInternalServerError, ""))
+	}
+}
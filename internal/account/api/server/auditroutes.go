@@ -0,0 +1,45 @@
+package server
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// outboxRoutes are the mutations whose usecase records the audit event through
+// the outbox (outbox.WithinTx) along with the change, by method and route
+// pattern. Only these can be made fail-closed by the audit rules.
+var outboxRoutes = []string{
+	http.MethodPost + " /accounts/",
+	http.MethodPatch + " /accounts/{resourceID}",
+	http.MethodDelete + " /accounts/{resourceID}",
+	http.MethodPost + " /admin/api-keys/",
+	http.MethodPost + " /admin/api-keys/{resourceID}/rotate",
+	http.MethodDelete + " /admin/api-keys/{resourceID}",
+}
+
+// VerifyFailClosedRoutes refuses audit rules making fail-closed a mutation of
+// routes that does not record its event through the outbox: its change would
+// be committed before its event could be, and it could no longer be rejected.
+func VerifyFailClosedRoutes(routes chi.Routes, rules *auditrules.Rules) error {
+	var unrecorded []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if method == http.MethodGet || method == http.MethodHead || !rules.FailClosed(route, method) {
+			return nil
+		}
+		if !slices.Contains(outboxRoutes, method+" "+route) {
+			unrecorded = append(unrecorded, method+" "+route)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(unrecorded) > 0 {
+		return fmt.Errorf("fail-closed routes that do not record their audit event through the outbox: %s", strings.Join(unrecorded, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditmw"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/ramk42/omi-backend-assignment/pkg/authz"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+// AuthorizationMiddleware enforces the policy on the actions of resourceType.
+// It must run inside the audit middleware so that denied attempts are audited.
+func AuthorizationMiddleware(policy *authz.Policy, resourceType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subject, ok := authorizationSubject(r)
+			resourceID := chi.URLParam(r, "resourceID")
+			action := auditmw.Action(resourceType, r.Method, resourceID)
+
+			decision := authz.Decision{Reason: "unidentified caller"}
+			if ok {
+				decision = policy.Authorize(subject, action, resourceID)
+			}
+
+			draft := logsreporting.DraftFromContext(r.Context())
+			draft.Annotate("authz_reason", decision.Reason)
+			if !decision.Allowed {
+				draft.Annotate("outcome", auditmw.OutcomeDenied)
+				logsreporting.FlagSecurity(r.Context(), logsreporting.ReasonAccessDenied, decision.Reason, auditActor(r.Context()))
+				log.Ctx(r.Context()).Warn().Str("subject", subject.Type+":"+subject.ID).Str("action", action).Str("reason", decision.Reason).Msg("access denied")
+				writeProblem(w, newProblem(r, http.StatusForbidden, "you are not allowed to perform "+action))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizationSubject identifies the caller from the authenticated principal.
+func authorizationSubject(r *http.Request) (authz.Subject, bool) {
+	principal := auth.PrincipalFromContext(r.Context())
+	if principal == nil {
+		return authz.Subject{}, false
+	}
+	return authz.Subject{ID: principal.ID, Type: principal.Type, Roles: principal.Roles}, true
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidIfMatch = errors.New("If-Match must be \"*\" or a single strong entity tag")
+
+// formatETag renders an account version as a strong entity tag.
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch returns the version required by an If-Match header, 0 when the
+// header is absent or "*". Tags that cannot be one of ours yield -1, which never matches.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, errInvalidIfMatch
+	}
+	if strings.HasPrefix(header, "W/") {
+		// weak tags never match under the strong comparison required by If-Match
+		return -1, nil
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		return -1, nil
+	}
+	return version, nil
+}
@@ -1,19 +1,22 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
-	"github.com/google/uuid"
+	"expvar"
 	"github.com/ramk42/omi-backend-assignment/internal/account/usecase"
+	apikeyusecase "github.com/ramk42/omi-backend-assignment/internal/apikey/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditmw"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/ramk42/omi-backend-assignment/pkg/authz"
 	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
 	"github.com/rs/zerolog/log"
-	"io"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -21,12 +24,42 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func Run(ctx context.Context, logsReportingProducer logsreporting.Producer) {
+// ScopeAPIKeysAdmin grants access to the API key administration endpoints.
+const ScopeAPIKeysAdmin = "apikeys:admin"
+
+func Run(
+	ctx context.Context,
+	logsReportingProducer logsreporting.Producer,
+	syncProducer logsreporting.SyncProducer,
+	dedup *logsreporting.Deduplicator,
+	accountUsecase usecase.AccountPort,
+	apiKeyUsecase apikeyusecase.APIKeyPort,
+	authenticator auth.Authenticator,
+	policy *authz.Policy,
+	auditRules *auditrules.Rules,
+	redaction *redact.Policy,
+	debugAddr string,
+) {
+
+	// Internal listener of the runtime metrics, kept off the public one
+	if debugAddr != "" {
+		debugServer := &http.Server{Addr: debugAddr, Handler: debugService()}
+		go func() {
+			if err := debugServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Str("addr", debugAddr).Msg("failed to start debug server")
+			}
+		}()
+		defer debugServer.Close()
+	}
 
 	// Server run context
 	serverCtx, serverStopCtx := context.WithCancel(ctx)
+	router := service(serverCtx, logsReportingProducer, syncProducer, dedup, accountUsecase, apiKeyUsecase, authenticator, policy, auditRules, redaction)
+	if err := VerifyFailClosedRoutes(router, auditRules); err != nil {
+		log.Fatal().Err(err).Msg("invalid audit rules")
+	}
 	// The HTTP Server
-	server := &http.Server{Addr: "0.0.0.0:8080", Handler: service(serverCtx, logsReportingProducer)}
+	server := &http.Server{Addr: "0.0.0.0:8080", Handler: router}
 
 	// Listen for syscall signals for process to interrupt/quit
 	sig := make(chan os.Signal, 1)
@@ -35,7 +68,8 @@ func Run(ctx context.Context, logsReportingProducer logsreporting.Producer) {
 		<-sig
 		log.Info().Msg("shutdown signal received - Starting graceful shutdown...")
 		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
+		defer cancel()
 
 		go func() {
 			<-shutdownCtx.Done()
@@ -63,26 +97,66 @@ func Run(ctx context.Context, logsReportingProducer logsreporting.Producer) {
 	<-serverCtx.Done()
 }
 
-func service(serverCtx context.Context, logsReportingProducer logsreporting.Producer) http.Handler {
+func service(
+	serverCtx context.Context,
+	logsReportingProducer logsreporting.Producer,
+	syncProducer logsreporting.SyncProducer,
+	dedup *logsreporting.Deduplicator,
+	accountUsecase usecase.AccountPort,
+	apiKeyUsecase apikeyusecase.APIKeyPort,
+	authenticator auth.Authenticator,
+	policy *authz.Policy,
+	auditRules *auditrules.Rules,
+	redaction *redact.Policy,
+) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(RequestLogger)
 	r.Use(middleware.RealIP)
+	r.Use(SecurityMiddleware(serverCtx, logsReportingProducer, dedup))
 
 	r.Route("/accounts", func(r chi.Router) {
-		r.Use(AuditLogMiddleware(serverCtx, logsReportingProducer, "account"))
-		accounUsecase := usecase.NewAccount()
-		accountHandler := &AccountHandler{accountUsecase: accounUsecase}
-		r.Patch("/{resourceID}", accountHandler.Patch)
+		r.Use(auth.Middleware(authenticator, FlagAuthFailure))
+		// group middlewares run once the route is matched, so they see its pattern and parameters
+		r.Group(func(r chi.Router) {
+			r.Use(auditLogMiddleware(serverCtx, logsReportingProducer, syncProducer, dedup, auditRules, redaction, "account"))
+			r.Use(AuthorizationMiddleware(policy, "account"))
+			accountHandler := NewAccountHandler(accountUsecase)
+			r.Post("/", accountHandler.Create)
+			r.Get("/", accountHandler.List)
+			r.Get("/{resourceID}", accountHandler.Get)
+			r.Patch("/{resourceID}", accountHandler.Patch)
+			r.Delete("/{resourceID}", accountHandler.Delete)
+		})
+	})
+
+	r.Route("/admin/api-keys", func(r chi.Router) {
+		r.Use(auth.Middleware(authenticator, FlagAuthFailure))
+		r.Use(auth.RequireScope(ScopeAPIKeysAdmin, FlagAuthFailure))
+		r.Group(func(r chi.Router) {
+			r.Use(auditLogMiddleware(serverCtx, logsReportingProducer, syncProducer, dedup, auditRules, redaction, "api_key"))
+			apiKeyHandler := &APIKeyHandler{apiKeyUsecase: apiKeyUsecase}
+			r.Post("/", apiKeyHandler.Issue)
+			r.Get("/", apiKeyHandler.List)
+			r.Post("/{resourceID}/rotate", apiKeyHandler.Rotate)
+			r.Delete("/{resourceID}", apiKeyHandler.Revoke)
+		})
 	})
 
 	return r
 }
 
+// debugService exposes the expvar metrics. It exposes the command line and
+// memory statistics of the process, so it must only be served on an internal address.
+func debugService() http.Handler {
+	r := chi.NewRouter()
+	r.Handle("/debug/vars", expvar.Handler())
+	return r
+}
+
 type responseRecorder struct {
 	http.ResponseWriter
 	statusCode int
-	body       *bytes.Buffer
 }
 
 func (rr *responseRecorder) WriteHeader(statusCode int) {
@@ -116,66 +190,46 @@ func RequestLogger(next http.Handler) http.Handler {
 	})
 }
 
-func AuditLogMiddleware(serverCtx context.Context, logsReportingProducer logsreporting.Producer, resourceType string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			requestID := middleware.GetReqID(r.Context())
-			var requestPayload json.RawMessage
-			var compactPayload bytes.Buffer
-			if r.Body != nil {
-				bodyBytes, _ := io.ReadAll(r.Body)
-				_ = json.Unmarshal(bodyBytes, &requestPayload)
-				_ = json.Compact(&compactPayload, bodyBytes)
-				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			}
-			recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK, body: new(bytes.Buffer)}
-			next.ServeHTTP(recorder, r)
-
-			var responsePayload json.RawMessage
-			if recorder.body.Len() > 0 {
-				_ = json.Unmarshal(recorder.body.Bytes(), &responsePayload)
-			}
-
-			auditLog := &logsreporting.AuditLog{} // we can optimize this using sync.Pool
-
-			subject := "event:" + resourceType
-			if resourceType != "" {
-				subject = subject + ":" + chi.URLParam(r, "resourceID")
-			}
+// auditLogMiddleware audits the requests on the resources of resourceType, on behalf of their authenticated principal.
+func auditLogMiddleware(
+	serverCtx context.Context,
+	logsReportingProducer logsreporting.Producer,
+	syncProducer logsreporting.SyncProducer,
+	dedup *logsreporting.Deduplicator,
+	rules *auditrules.Rules,
+	redaction *redact.Policy,
+	resourceType string,
+) func(http.Handler) http.Handler {
+	return auditmw.New(logsReportingProducer,
+		auditmw.WithBaseContext(serverCtx),
+		auditmw.WithSyncProducer(syncProducer),
+		auditmw.WithDeduplicator(dedup),
+		auditmw.WithRules(rules),
+		auditmw.WithRedaction(redaction),
+		auditmw.WithResourceType(resourceType),
+		auditmw.WithActorResolver(auditActor),
+	)
+}
 
-			resourceID := chi.URLParam(r, "resourceID")
-			auditLog.SpecVersion = "1.0"
-			auditLog.ID = uuid.NewString()
-			auditLog.Source = "backend.api" // to in consts
-			auditLog.Type = "audit.event"   // to in consts etc...
-			auditLog.Subject = subject
-			auditLog.Timestamp = time.Now().UTC()
-			auditLog.Actor = map[string]string{
-				"id": uuid.NewString(), // we assume that we have authenticated user
-			}
-			auditLog.Action = r.Method
-			auditLog.Resource = map[string]any{
-				"id":   resourceID,
-				"type": resourceType,
-				"attributes": map[string]string{
-					"id":         resourceID,
-					"type":       resourceType,
-					"attributes": compactPayload.String(),
-				},
-			}
-			auditLog.Metadata = map[string]string{
-				"request_id":      requestID,
-				"response_status": strconv.Itoa(recorder.statusCode),
-				"protocol":        r.Proto,
-			}
-			// we don't block the request to publish the audit event
-			go func() {
-				err := logsReportingProducer.Publish(serverCtx, auditLog)
-				if err != nil {
-					log.Error().Err(err).Msg("failure to publish audit event")
-					return
-				}
-			}()
-		})
+// auditActor describes the authenticated principal of the request.
+func auditActor(ctx context.Context) logsreporting.Actor {
+	principal := auth.PrincipalFromContext(ctx)
+	if principal == nil {
+		return logsreporting.Actor{Type: logsreporting.ActorAnonymous}
+	}
+	actor := logsreporting.Actor{
+		ID:     principal.ID,
+		Type:   principal.Type,
+		Tenant: principal.Tenant,
+	}
+	if principal.CredentialID != "" {
+		actor.Extra = map[string]string{"key_id": principal.CredentialID}
+	}
+	if len(principal.Scopes) > 0 {
+		if actor.Extra == nil {
+			actor.Extra = map[string]string{}
+		}
+		actor.Extra["scopes"] = strings.Join(principal.Scopes, " ")
 	}
+	return actor
 }
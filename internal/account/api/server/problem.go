@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+const (
+	contentTypeProblem = "application/problem+json"
+
+	problemTypeValidation = "/problems/validation-error"
+)
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Errors   []ProblemFieldError `json:"errors,omitempty"`
+}
+
+// ProblemFieldError points a validation message at the request field it relates to.
+type ProblemFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func newProblem(r *http.Request, status int, detail string) *Problem {
+	return &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, problem *Problem) {
+	w.Header().Set("Content-Type", contentTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Error().Err(err).Msg("failed to write problem body")
+	}
+}
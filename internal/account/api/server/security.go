@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// securityDedupWindow collapses the security events of a source ip for a reason.
+const securityDedupWindow = time.Minute
+
+// SecurityMiddleware reports the requests that failed authentication or
+// authorization, carried a malformed payload or panicked as security.* events.
+// It runs at the router level, after RealIP, so that it sees every request,
+// including the ones rejected before reaching the audited routes.
+//
+// The events but panics are collapsed per source ip and reason by dedup, when
+// set, and never wait for room in the producer: a flood of rejected requests
+// must not stall the legitimate ones.
+//
+// It also recovers from panics, answering with a 500.
+func SecurityMiddleware(serverCtx context.Context, logsReportingProducer logsreporting.Producer, dedup *logsreporting.Deduplicator) func(http.Handler) http.Handler {
+	// canceled up front, so that a full queue drops (or spools) the event instead of blocking
+	nonBlockingCtx, cancel := context.WithCancel(serverCtx)
+	cancel()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			flag := &logsreporting.SecurityFlag{}
+			r = r.WithContext(logsreporting.ContextWithSecurityFlag(r.Context(), flag))
+			recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					if recovered == http.ErrAbortHandler {
+						panic(recovered)
+					}
+					log.Ctx(r.Context()).Error().Interface("panic", recovered).Bytes("stack", debug.Stack()).Msg("recovered from panic")
+					flag.Flag(logsreporting.ReasonPanic, fmt.Sprint(recovered), logsreporting.Actor{})
+					writeProblem(recorder, newProblem(r, http.StatusInternalServerError, ""))
+				}
+
+				event := securityEvent(r, flag, recorder.statusCode)
+				if event == nil {
+					return
+				}
+				if event.Type == logsreporting.EventTypePanic {
+					if err := logsReportingProducer.Publish(serverCtx, event); err != nil {
+						log.Error().Err(err).Str("type", event.Type).Msg("failure to publish security event")
+					}
+					return
+				}
+				if dedup != nil {
+					key := event.Type + "|" + event.Context.IP + "|" + event.Context.Get("reason")
+					dedup.AddKeyed(nonBlockingCtx, key, event, securityDedupWindow)
+					return
+				}
+				if err := logsReportingProducer.Publish(nonBlockingCtx, event); err != nil {
+					log.Error().Err(err).Str("type", event.Type).Msg("failure to publish security event")
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+// securityEvent builds the event of a suspicious request, nil when it is not.
+func securityEvent(r *http.Request, flag *logsreporting.SecurityFlag, status int) *logsreporting.AuditLog {
+	reason, detail, actor := flag.Reason()
+
+	var eventType string
+	switch {
+	case reason == logsreporting.ReasonPanic:
+		eventType = logsreporting.EventTypePanic
+	case status == http.StatusUnauthorized:
+		eventType = logsreporting.EventTypeAuthenticationFailed
+		if reason == "" {
+			reason = "unauthenticated"
+		}
+	case status == http.StatusForbidden:
+		eventType = logsreporting.EventTypeAccessDenied
+		if reason == "" {
+			reason = "forbidden"
+		}
+	case reason == logsreporting.ReasonMalformedPayload && status >= http.StatusBadRequest:
+		eventType = logsreporting.EventTypeMalformedRequest
+	default:
+		return nil
+	}
+	if !actor.Known() {
+		actor = logsreporting.Actor{Type: logsreporting.ActorAnonymous}
+	}
+
+	path := r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		path = rctx.RoutePattern()
+	}
+	event, err := logsreporting.NewEvent(eventType, "backend.api").
+		Subject("security:" + path).
+		Actor(actor).
+		Action(eventType).
+		Resource(logsreporting.Resource{ID: r.URL.Path, Type: "http_request"}).
+		Context(logsreporting.Context{
+			RequestID:      middleware.GetReqID(r.Context()),
+			IP:             logsreporting.ClientIP(r.RemoteAddr),
+			UserAgent:      r.UserAgent(),
+			Method:         r.Method,
+			ResponseStatus: status,
+			Extra:          map[string]string{"reason": reason, "detail": detail},
+		}).
+		Build()
+	if err != nil {
+		log.Ctx(r.Context()).Error().Err(err).Msg("failure to build security event")
+		return nil
+	}
+	return event
+}
+
+// FlagAuthFailure is the auth.FailureHook reporting the rejected requests to the security middleware.
+func FlagAuthFailure(r *http.Request, err error, principal *auth.Principal) {
+	reason := logsreporting.ReasonInvalidCredentials
+	switch {
+	case errors.Is(err, auth.ErrMissingCredentials):
+		reason = logsreporting.ReasonMissingCredentials
+	case errors.Is(err, auth.ErrInsufficientScope):
+		reason = logsreporting.ReasonInsufficientScope
+	}
+	var actor logsreporting.Actor
+	if principal != nil {
+		actor = logsreporting.Actor{ID: principal.ID, Type: principal.Type}
+	}
+	logsreporting.FlagSecurity(r.Context(), reason, err.Error(), actor)
+}
@@ -0,0 +1,259 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/ramk42/omi-backend-assignment/internal/account"
+	"github.com/ramk42/omi-backend-assignment/internal/account/api/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeAccountUsecase records the patch and expected version it is called
+// with, and fails the writes with err when set.
+type fakeAccountUsecase struct {
+	patch           *account.Patch
+	expectedVersion *int64
+	err             error
+}
+
+func (f *fakeAccountUsecase) Create(_ context.Context, acc account.Account) (*account.Account, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &acc, nil
+}
+
+func (f *fakeAccountUsecase) Get(_ context.Context, id string) (*account.Account, error) {
+	return &account.Account{ID: id, Version: 1}, nil
+}
+
+func (f *fakeAccountUsecase) List(_ context.Context, _ account.ListFilter) (*account.Page, error) {
+	return &account.Page{}, nil
+}
+
+func (f *fakeAccountUsecase) Patch(_ context.Context, id string, patch account.Patch) (*account.Mutation, error) {
+	f.patch = &patch
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &account.Mutation{After: account.Account{ID: id, Version: 2}}, nil
+}
+
+func (f *fakeAccountUsecase) Delete(_ context.Context, id string, expectedVersion int64) (*account.Account, error) {
+	f.expectedVersion = &expectedVersion
+	return &account.Account{ID: id}, nil
+}
+
+func accountRouter(accountUsecase *fakeAccountUsecase) http.Handler {
+	handler := server.NewAccountHandler(accountUsecase)
+	r := chi.NewRouter()
+	r.Post("/accounts", handler.Create)
+	r.Patch("/accounts/{resourceID}", handler.Patch)
+	r.Delete("/accounts/{resourceID}", handler.Delete)
+	return r
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestAccountHandler_PatchDocument(t *testing.T) {
+	tests := map[string]struct {
+		contentType string
+		body        string
+		status      int
+		want        account.Patch
+	}{
+		"merge patch sets present members only": {contentType: "application/merge-patch+json", body: `{"name":"Jane"}`,
+			status: http.StatusOK, want: account.Patch{Name: ptr("Jane")}},
+		"merge patch with charset": {contentType: "application/merge-patch+json; charset=utf-8", body: `{"email":"jane@example.com"}`,
+			status: http.StatusOK, want: account.Patch{Email: ptr("jane@example.com")}},
+		"plain json is a merge patch": {contentType: "application/json", body: `{"name":"Jane","email":"jane@example.com"}`,
+			status: http.StatusOK, want: account.Patch{Name: ptr("Jane"), Email: ptr("jane@example.com")}},
+		"missing content type is a merge patch": {body: `{"name":"Jane"}`,
+			status: http.StatusOK, want: account.Patch{Name: ptr("Jane")}},
+		"merge patch empty object": {contentType: "application/merge-patch+json", body: `{}`,
+			status: http.StatusOK, want: account.Patch{}},
+		"merge patch null removes a required field": {contentType: "application/merge-patch+json", body: `{"email":null}`,
+			status: http.StatusUnprocessableEntity},
+		"merge patch unknown field": {contentType: "application/merge-patch+json", body: `{"role":"admin"}`,
+			status: http.StatusUnprocessableEntity},
+		"merge patch non string value": {contentType: "application/merge-patch+json", body: `{"name":42}`,
+			status: http.StatusBadRequest},
+		"merge patch not an object": {contentType: "application/merge-patch+json", body: `["name"]`,
+			status: http.StatusBadRequest},
+		"merge patch null document": {contentType: "application/merge-patch+json", body: `null`,
+			status: http.StatusBadRequest},
+		"unsupported media type": {contentType: "text/plain", body: `name=Jane`,
+			status: http.StatusUnsupportedMediaType},
+		"unparsable media type": {contentType: "application/", body: `{}`,
+			status: http.StatusUnsupportedMediaType},
+		"json patch replace and add": {contentType: "application/json-patch+json",
+			body:   `[{"op":"replace","path":"/name","value":"Jane"},{"op":"add","path":"/email","value":"jane@example.com"}]`,
+			status: http.StatusOK, want: account.Patch{Name: ptr("Jane"), Email: ptr("jane@example.com")}},
+		"json patch test is a precondition": {contentType: "application/json-patch+json",
+			body:   `[{"op":"test","path":"/email","value":"john@example.com"},{"op":"replace","path":"/name","value":"Jane"}]`,
+			status: http.StatusOK, want: account.Patch{Name: ptr("Jane"), Expected: map[string]string{"email": "john@example.com"}}},
+		"json patch test after replace of the same field": {contentType: "application/json-patch+json",
+			body:   `[{"op":"replace","path":"/name","value":"Jane"},{"op":"test","path":"/name","value":"Jane"}]`,
+			status: http.StatusOK, want: account.Patch{Name: ptr("Jane")}},
+		"json patch failing test after replace": {contentType: "application/json-patch+json",
+			body:   `[{"op":"replace","path":"/name","value":"Jane"},{"op":"test","path":"/name","value":"John"}]`,
+			status: http.StatusConflict},
+		"json patch remove": {contentType: "application/json-patch+json", body: `[{"op":"remove","path":"/email"}]`,
+			status: http.StatusUnprocessableEntity},
+		"json patch unsupported op": {contentType: "application/json-patch+json", body: `[{"op":"move","from":"/name","path":"/email"}]`,
+			status: http.StatusUnprocessableEntity},
+		"json patch unknown path": {contentType: "application/json-patch+json", body: `[{"op":"replace","path":"/id","value":"x"}]`,
+			status: http.StatusUnprocessableEntity},
+		"json patch path without leading slash": {contentType: "application/json-patch+json", body: `[{"op":"replace","path":"name","value":"x"}]`,
+			status: http.StatusUnprocessableEntity},
+		"json patch missing value": {contentType: "application/json-patch+json", body: `[{"op":"replace","path":"/name"}]`,
+			status: http.StatusBadRequest},
+		"json patch non string value": {contentType: "application/json-patch+json", body: `[{"op":"replace","path":"/name","value":true}]`,
+			status: http.StatusBadRequest},
+		"json patch not an array": {contentType: "application/json-patch+json", body: `{"op":"replace"}`,
+			status: http.StatusBadRequest},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			accountUsecase := &fakeAccountUsecase{}
+			req := httptest.NewRequest(http.MethodPatch, "/accounts/42", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			accountRouter(accountUsecase).ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.status != http.StatusOK {
+				assert.Nil(t, accountUsecase.patch)
+				return
+			}
+			require.NotNil(t, accountUsecase.patch)
+			assert.Equal(t, tt.want, *accountUsecase.patch)
+		})
+	}
+}
+
+func TestAccountHandler_PatchUnsupportedMediaTypeAdvertisesFormats(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPatch, "/accounts/42", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/xml")
+	rec := httptest.NewRecorder()
+	accountRouter(&fakeAccountUsecase{}).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Equal(t, "application/merge-patch+json, application/json-patch+json", rec.Header().Get("Accept-Patch"))
+}
+
+func TestAccountHandler_IfMatch(t *testing.T) {
+	tests := map[string]struct {
+		ifMatch string
+		status  int
+		version int64
+	}{
+		"absent":             {status: http.StatusNoContent, version: 0},
+		"any":                {ifMatch: "*", status: http.StatusNoContent, version: 0},
+		"strong tag":         {ifMatch: `"7"`, status: http.StatusNoContent, version: 7},
+		"surrounding spaces": {ifMatch: ` "7" `, status: http.StatusNoContent, version: 7},
+		"weak tag":           {ifMatch: `W/"7"`, status: http.StatusNoContent, version: -1},
+		"foreign tag":        {ifMatch: `"abc"`, status: http.StatusNoContent, version: -1},
+		"zero version":       {ifMatch: `"0"`, status: http.StatusNoContent, version: -1},
+		"negative version":   {ifMatch: `"-3"`, status: http.StatusNoContent, version: -1},
+		"unquoted":           {ifMatch: `7`, status: http.StatusBadRequest},
+		"unterminated quote": {ifMatch: `"7`, status: http.StatusBadRequest},
+		"lone quote":         {ifMatch: `"`, status: http.StatusBadRequest},
+		"several tags":       {ifMatch: `"7", "8"`, status: http.StatusBadRequest},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			accountUsecase := &fakeAccountUsecase{}
+			req := httptest.NewRequest(http.MethodDelete, "/accounts/42", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			accountRouter(accountUsecase).ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.status != http.StatusNoContent {
+				assert.Nil(t, accountUsecase.expectedVersion)
+				return
+			}
+			require.NotNil(t, accountUsecase.expectedVersion)
+			assert.Equal(t, tt.version, *accountUsecase.expectedVersion)
+		})
+	}
+}
+
+func TestAccountHandler_PatchETag(t *testing.T) {
+	accountUsecase := &fakeAccountUsecase{}
+	req := httptest.NewRequest(http.MethodPatch, "/accounts/42", strings.NewReader(`{"name":"Jane"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+	accountRouter(accountUsecase).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, accountUsecase.patch)
+	assert.Equal(t, int64(1), accountUsecase.patch.Version)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+}
+
+func TestAccountHandler_PatchBodyLimit(t *testing.T) {
+	tests := map[string]struct {
+		nameSize int
+		status   int
+	}{
+		"within the limit": {nameSize: 64<<10 - len(`{"name":""}`), status: http.StatusOK},
+		"over the limit":   {nameSize: 64<<10 - len(`{"name":""}`) + 1, status: http.StatusRequestEntityTooLarge},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			accountUsecase := &fakeAccountUsecase{}
+			body := `{"name":"` + strings.Repeat("a", tt.nameSize) + `"}`
+			req := httptest.NewRequest(http.MethodPatch, "/accounts/42", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			rec := httptest.NewRecorder()
+			accountRouter(accountUsecase).ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusOK {
+				assert.NotNil(t, accountUsecase.patch)
+				return
+			}
+			assert.Nil(t, accountUsecase.patch)
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Body.String(), "65536 bytes")
+		})
+	}
+}
+
+func TestAccountHandler_EmailTaken(t *testing.T) {
+	tests := map[string]struct {
+		method, path, contentType, body string
+	}{
+		"create": {method: http.MethodPost, path: "/accounts", contentType: "application/json", body: `{"name":"Jane","email":"jane@example.com"}`},
+		"patch":  {method: http.MethodPatch, path: "/accounts/42", contentType: "application/merge-patch+json", body: `{"email":"jane@example.com"}`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			accountRouter(&fakeAccountUsecase{err: account.ErrEmailTaken}).ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusConflict, rec.Code)
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+			var problem server.Problem
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+			assert.Equal(t, []server.ProblemFieldError{{Field: "email", Message: "is already in use"}}, problem.Errors)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/ramk42/omi-backend-assignment/internal/account/api/server"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serviceRoutes lays out the routes as the service does, plus extra ones.
+func serviceRoutes(extra func(r chi.Router)) chi.Routes {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r := chi.NewRouter()
+	r.Route("/accounts", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Post("/", handler)
+			r.Get("/", handler)
+			r.Get("/{resourceID}", handler)
+			r.Patch("/{resourceID}", handler)
+			r.Delete("/{resourceID}", handler)
+			if extra != nil {
+				extra(r)
+			}
+		})
+	})
+	r.Route("/admin/api-keys", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Post("/", handler)
+			r.Get("/", handler)
+			r.Post("/{resourceID}/rotate", handler)
+			r.Delete("/{resourceID}", handler)
+		})
+	})
+	return r
+}
+
+func TestVerifyFailClosedRoutes(t *testing.T) {
+	shipped, err := auditrules.LoadFile(filepath.Join("..", "..", "..", "..", "..", "config", "audit-rules.json"))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"defaults": {"fail_closed": true}}`), 0o600))
+	everything, err := auditrules.LoadFile(path)
+	require.NoError(t, err)
+
+	unrecorded := func(r chi.Router) {
+		r.Post("/{resourceID}/merge", func(w http.ResponseWriter, r *http.Request) {})
+	}
+	tests := map[string]struct {
+		rules   *auditrules.Rules
+		extra   func(r chi.Router)
+		wantErr string
+	}{
+		"shipped rules":                      {rules: shipped},
+		"every route fail-closed":            {rules: everything},
+		"mutation without outbox":            {rules: shipped, extra: unrecorded, wantErr: "POST /accounts/{resourceID}/merge"},
+		"mutation without outbox fail-open":  {rules: nil, extra: unrecorded},
+		"reads are never recorded in outbox": {rules: everything, extra: func(r chi.Router) { r.Get("/{resourceID}/history", func(w http.ResponseWriter, r *http.Request) {}) }},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := server.VerifyFailClosedRoutes(serviceRoutes(tt.extra), tt.rules)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package server_test
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/ramk42/omi-backend-assignment/internal/account/api/server"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/ramk42/omi-backend-assignment/pkg/authz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthorizationMiddleware_IgnoresIdentityHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+	  "roles": {"admin": ["account.*"]},
+	  "bindings": {"user:alice": ["admin"]},
+	  "identity_headers": {"id": "X-User-Id", "roles": "X-User-Roles"}
+	}`), 0o600))
+	policy, err := authz.LoadFile(path)
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(server.AuthorizationMiddleware(policy, "account"))
+	r.Get("/accounts", func(w http.ResponseWriter, r *http.Request) {})
+	withPrincipal := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), &auth.Principal{ID: "alice", Type: auth.PrincipalUser})))
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	req.Header.Set("X-User-Id", "alice")
+	req.Header.Set("X-User-Roles", "admin")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = httptest.NewRecorder()
+	withPrincipal(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,149 @@
+package server_test
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ramk42/omi-backend-assignment/internal/account/api/server"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type fakeProducer struct {
+	mu     sync.Mutex
+	events []*logsreporting.AuditLog
+}
+
+func (f *fakeProducer) Publish(_ context.Context, event *logsreporting.AuditLog) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+type staticAuthenticator struct{}
+
+func (staticAuthenticator) Authenticate(_ context.Context, token string) (*auth.Principal, error) {
+	if token != "valid" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return &auth.Principal{ID: "alice", Type: auth.PrincipalUser}, nil
+}
+
+func securityRouter(producer *fakeProducer, dedup *logsreporting.Deduplicator) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.RealIP)
+	r.Use(server.SecurityMiddleware(context.Background(), producer, dedup))
+	r.Route("/accounts", func(r chi.Router) {
+		r.Use(auth.Middleware(staticAuthenticator{}, server.FlagAuthFailure))
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+		r.With(auth.RequireScope("accounts:admin", server.FlagAuthFailure)).Delete("/{resourceID}", func(w http.ResponseWriter, r *http.Request) {})
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	})
+	return r
+}
+
+func TestSecurityMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		method, token string
+		path          string
+		status        int
+		eventType     string
+		reason        string
+		actorID       string
+	}{
+		"missing credentials": {method: http.MethodGet, path: "/accounts", status: http.StatusUnauthorized,
+			eventType: logsreporting.EventTypeAuthenticationFailed, reason: logsreporting.ReasonMissingCredentials},
+		"invalid token": {method: http.MethodGet, path: "/accounts", token: "forged", status: http.StatusUnauthorized,
+			eventType: logsreporting.EventTypeAuthenticationFailed, reason: logsreporting.ReasonInvalidCredentials},
+		"missing scope": {method: http.MethodDelete, path: "/accounts/42", token: "valid", status: http.StatusForbidden,
+			eventType: logsreporting.EventTypeAccessDenied, reason: logsreporting.ReasonInsufficientScope, actorID: "alice"},
+		"panic": {method: http.MethodPost, path: "/accounts", token: "valid", status: http.StatusInternalServerError,
+			eventType: logsreporting.EventTypePanic, reason: logsreporting.ReasonPanic},
+		"legit request": {method: http.MethodGet, path: "/accounts", token: "valid", status: http.StatusOK},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			producer := &fakeProducer{}
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("User-Agent", "curl/8.0")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			securityRouter(producer, nil).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.eventType == "" {
+				assert.Empty(t, producer.events)
+				return
+			}
+			require.Len(t, producer.events, 1)
+			event := producer.events[0]
+			assert.Equal(t, tt.eventType, event.Type)
+			assert.Equal(t, tt.reason, event.Context.Get("reason"))
+			assert.Equal(t, "203.0.113.7", event.Context.IP)
+			assert.Equal(t, "curl/8.0", event.Context.UserAgent)
+			if tt.actorID != "" {
+				assert.Equal(t, tt.actorID, event.Actor.ID)
+			}
+		})
+	}
+}
+
+func TestSecurityMiddleware_CollapsesFloodPerSource(t *testing.T) {
+	tests := map[string]func(req *http.Request, ip string, i int){
+		"forwarded address": func(req *http.Request, ip string, _ int) {
+			req.Header.Set("X-Forwarded-For", ip)
+		},
+		"remote address from different ports": func(req *http.Request, ip string, i int) {
+			req.RemoteAddr = net.JoinHostPort(ip, strconv.Itoa(40000+i))
+		},
+	}
+	for name, setSource := range tests {
+		t.Run(name, func(t *testing.T) {
+			producer := &fakeProducer{}
+			dedup := logsreporting.NewDeduplicator(producer, 0)
+			router := securityRouter(producer, dedup)
+			for i, ip := range []string{"203.0.113.7", "203.0.113.7", "203.0.113.7", "198.51.100.1"} {
+				req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+				setSource(req, ip, i)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				require.Equal(t, http.StatusUnauthorized, rec.Code)
+			}
+			assert.Empty(t, producer.events, "events are held until their window closes")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			dedup.Run(ctx)
+
+			counts := map[string]string{}
+			for _, event := range producer.events {
+				assert.Equal(t, logsreporting.ReasonMissingCredentials, event.Context.Get("reason"))
+				counts[event.Context.IP] = event.Context.Get("access_count")
+			}
+			assert.Equal(t, map[string]string{"203.0.113.7": "3", "198.51.100.1": "1"}, counts)
+		})
+	}
+}
+
+func TestSecurityMiddleware_PanicsAreNotCollapsed(t *testing.T) {
+	producer := &fakeProducer{}
+	router := securityRouter(producer, logsreporting.NewDeduplicator(producer, 0))
+	req := httptest.NewRequest(http.MethodPost, "/accounts", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, producer.events, 1)
+	assert.Equal(t, logsreporting.EventTypePanic, producer.events[0].Type)
+}
@@ -3,24 +3,189 @@ package main
 import (
 	"context"
 	"github.com/ramk42/omi-backend-assignment/internal/account/api/server"
+	"github.com/ramk42/omi-backend-assignment/internal/account/repository"
+	"github.com/ramk42/omi-backend-assignment/internal/account/usecase"
+	apikeyrepository "github.com/ramk42/omi-backend-assignment/internal/apikey/repository"
+	apikeyusecase "github.com/ramk42/omi-backend-assignment/internal/apikey/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/ramk42/omi-backend-assignment/pkg/authz"
+	"github.com/ramk42/omi-backend-assignment/pkg/database"
 	"github.com/ramk42/omi-backend-assignment/pkg/env"
 	"github.com/rs/zerolog/log"
 
 	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
 	"github.com/ramk42/omi-backend-assignment/pkg/natsclient"
+	"github.com/ramk42/omi-backend-assignment/pkg/outbox"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
+	"github.com/ramk42/omi-backend-assignment/pkg/spool"
 	"github.com/rs/zerolog"
 	"os"
+	"time"
 )
 
 func main() {
 	log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 	ctx := context.Background()
+	auditSpool := mustOpenAuditSpool()
+	if auditSpool != nil {
+		defer auditSpool.Close()
+	}
+
 	natURL := env.MustGetEnv[string]("NATS_URL")
 	conn, err := natsclient.New(natURL)
 	if err != nil {
 		log.Fatal().Err(err).Str("nats_url", natURL).Msg("failed to connect to nats")
 		return
 	}
-	auditReport := logsreporting.NewProducer(conn)
-	server.Run(ctx, auditReport)
+	auditSubjects, err := logsreporting.ParseSubjectTemplate(env.GetEnv("AUDIT_SUBJECT_TEMPLATE", logsreporting.DefaultSubjectTemplate))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid audit subject template")
+	}
+	auditReport, err := logsreporting.NewProducer(conn, logsreporting.Encoding{
+		ContentMode: env.GetEnv("AUDIT_CLOUDEVENTS_MODE", logsreporting.ContentModeStructured),
+		Format:      env.GetEnv("AUDIT_WIRE_FORMAT", logsreporting.FormatJSON),
+	}, auditSubjects)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid audit producer configuration")
+	}
+	// neither policy holds the requests when the queue is full
+	defaultOverflow := logsreporting.OverflowDropOldest
+	if auditSpool != nil {
+		defaultOverflow = logsreporting.OverflowSpill
+	}
+	publishQueue, err := logsreporting.NewQueue(auditReport, logsreporting.QueueConfig{
+		Size:           env.GetEnv("AUDIT_PUBLISH_QUEUE_SIZE", 10000),
+		Workers:        env.GetEnv("AUDIT_PUBLISH_WORKERS", 4),
+		Overflow:       env.GetEnv("AUDIT_PUBLISH_OVERFLOW", defaultOverflow),
+		Spool:          auditSpool,
+		PublishTimeout: time.Duration(env.GetEnv("AUDIT_PUBLISH_TIMEOUT_MS", 5000)) * time.Millisecond,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid audit publish queue configuration")
+	}
+	natsclient.OnReconnect(conn, publishQueue.Replay)
+	queueCtx, stopQueue := context.WithCancel(ctx)
+	queueDone := make(chan struct{})
+	go func() {
+		publishQueue.Run(queueCtx)
+		close(queueDone)
+	}()
+	defer func() {
+		stopQueue()
+		<-queueDone
+	}()
+
+	// stopped before the queue, so that the events it still holds are queued
+	dedup := logsreporting.NewDeduplicator(publishQueue, env.GetEnv("AUDIT_DEDUP_MAX_PENDING", logsreporting.DefaultDedupMaxPending))
+	dedupCtx, stopDedup := context.WithCancel(ctx)
+	dedupDone := make(chan struct{})
+	go func() {
+		dedup.Run(dedupCtx)
+		close(dedupDone)
+	}()
+	defer func() {
+		stopDedup()
+		<-dedupDone
+	}()
+
+	db := database.New(ctx, env.MustGetEnv[string]("DATABASE_URL"))
+	defer db.Close()
+	accountUsecase := usecase.NewAccount(repository.NewAccountRepository(db))
+
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	defer stopRelay()
+	relay := outbox.NewRelay(
+		db,
+		auditReport,
+		env.MustGetEnv[int]("AUDIT_OUTBOX_BATCH_SIZE"),
+		time.Duration(env.MustGetEnv[int]("AUDIT_OUTBOX_POLL_INTERVAL_SEC"))*time.Second,
+	)
+	go relay.Run(relayCtx)
+
+	apiKeyUsecase := apikeyusecase.NewAPIKey(apikeyrepository.NewAPIKeyRepository(db))
+
+	jwtVerifier := auth.NewJWTVerifier(
+		mustLoadJWTKeys(),
+		env.GetEnv("AUTH_JWT_ISSUER", ""),
+		env.GetEnv("AUTH_JWT_AUDIENCE", ""),
+	)
+	authenticator := auth.Prefixed(apikeyusecase.TokenPrefix, apiKeyUsecase, jwtVerifier)
+
+	policyFile := env.MustGetEnv[string]("AUTHZ_POLICY_FILE")
+	policy, err := authz.LoadFile(policyFile)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", policyFile).Msg("failed to load authorization policy")
+	}
+
+	server.Run(ctx, publishQueue, auditReport, dedup, accountUsecase, apiKeyUsecase, authenticator, policy, mustLoadAuditRules(), mustLoadRedactionPolicy(), env.GetEnv("DEBUG_ADDR", "127.0.0.1:6060"))
+}
+
+// minHMACSecretLength is the shortest HS256 secret accepted, 256 bits as the hash output.
+const minHMACSecretLength = 32
+
+// mustLoadJWTKeys gathers the keys configured to verify access tokens: a local
+// JWKS file, a PEM public key (RS256 or EdDSA) and/or an HS256 shared secret.
+func mustLoadJWTKeys() auth.KeySet {
+	var keys auth.KeySet
+	if path := env.GetEnv("AUTH_JWKS_FILE", ""); path != "" {
+		jwks, err := auth.LoadJWKSFile(path)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", path).Msg("failed to load JWKS")
+		}
+		keys = append(keys, jwks...)
+	}
+	if path := env.GetEnv("AUTH_JWT_PUBLIC_KEY_FILE", ""); path != "" {
+		key, err := auth.LoadPublicKeyFile(env.GetEnv("AUTH_JWT_PUBLIC_KEY_ID", ""), path)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", path).Msg("failed to load JWT public key")
+		}
+		keys = append(keys, key)
+	}
+	if secret := env.GetEnv("AUTH_JWT_HMAC_SECRET", ""); secret != "" {
+		if len(secret) < minHMACSecretLength {
+			log.Fatal().Int("min_length", minHMACSecretLength).Msg("AUTH_JWT_HMAC_SECRET is too short")
+		}
+		keys = append(keys, auth.HMACKey(env.GetEnv("AUTH_JWT_HMAC_KEY_ID", ""), []byte(secret)))
+	}
+	if len(keys) == 0 {
+		log.Fatal().Msg("no JWT verification key configured (AUTH_JWKS_FILE, AUTH_JWT_PUBLIC_KEY_FILE or AUTH_JWT_HMAC_SECRET)")
+	}
+	return keys
+}
+
+func mustLoadAuditRules() *auditrules.Rules {
+	path := env.MustGetEnv[string]("AUDIT_RULES_FILE")
+	rules, err := auditrules.LoadFile(path)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", path).Msg("failed to load audit rules")
+	}
+	return rules
+}
+
+func mustLoadRedactionPolicy() *redact.Policy {
+	path := env.MustGetEnv[string]("REDACTION_POLICY_FILE")
+	policy, err := redact.LoadFile(path, []byte(env.GetEnv("REDACTION_HMAC_KEY", "")))
+	if err != nil {
+		log.Fatal().Err(err).Str("path", path).Msg("failed to load redaction policy")
+	}
+	return policy
+}
+
+// mustOpenAuditSpool opens the durable spool of the audit events published
+// after the response, nil when AUDIT_SPOOL_DIR is not set.
+func mustOpenAuditSpool() *spool.WAL {
+	dir := env.GetEnv("AUDIT_SPOOL_DIR", "")
+	if dir == "" {
+		return nil
+	}
+	wal, err := spool.Open(dir, spool.Options{
+		Sync:         env.GetEnv("AUDIT_SPOOL_FSYNC", spool.SyncInterval),
+		SyncInterval: time.Duration(env.GetEnv("AUDIT_SPOOL_FSYNC_INTERVAL_MS", 100)) * time.Millisecond,
+		SegmentSize:  int64(env.GetEnv("AUDIT_SPOOL_SEGMENT_SIZE_MB", 16)) << 20,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Str("dir", dir).Msg("failed to open audit spool")
+	}
+	return wal
 }
@@ -0,0 +1,17 @@
+package account
+
+import "errors"
+
+// Usecase errors
+var (
+	ErrInvalidAccountID = errors.New("account id is not a valid uuid")
+	ErrPatchTestFailed  = errors.New("account does not match the patch preconditions")
+)
+
+// Repository errors
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrInvalidCursor   = errors.New("pagination cursor is invalid")
+	ErrEmailTaken      = errors.New("email is already used by another account")
+	ErrVersionMismatch = errors.New("account version does not match")
+)
@@ -1,8 +1,112 @@
 package account
 
+import "time"
+
 // Account represents a user account.
 type Account struct {
-	ID    string
-	Name  string
-	Email string
+	ID        string
+	Name      string
+	Email     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Version is incremented on every update and exposed as the ETag of the account.
+	Version int64
+}
+
+// Patch is a partial update of an account. A nil field is left untouched.
+type Patch struct {
+	Name  *string
+	Email *string
+	// Expected holds the values fields must currently have for the patch to be
+	// applied, keyed by field name.
+	Expected map[string]string
+	// Version is the version the account must have for the patch to be applied, 0 for any.
+	Version int64
+}
+
+// Mutation is the state of an account before and after a change.
+type Mutation struct {
+	Before  Account
+	After   Account
+	Changes []Change
+}
+
+// Change is the update of a single field. Old is nil for a created account
+// and New is nil for a deleted one.
+type Change struct {
+	Field string
+	Old   any
+	New   any
+}
+
+// Diff lists the fields whose value differs between two states of an account,
+// a nil state standing for an account that does not exist.
+func Diff(before, after *Account) []Change {
+	var changes []Change
+	for _, field := range []string{"name", "email"} {
+		var change Change
+		change.Field = field
+		if before != nil {
+			change.Old, _ = before.Field(field)
+		}
+		if after != nil {
+			change.New, _ = after.Field(field)
+		}
+		if change.Old != change.New {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Field returns the value of the field with the given JSON name.
+func (a *Account) Field(name string) (string, bool) {
+	switch name {
+	case "name":
+		return a.Name, true
+	case "email":
+		return a.Email, true
+	}
+	return "", false
+}
+
+// Satisfies reports whether every expected field holds the expected value.
+func (a *Account) Satisfies(expected map[string]string) bool {
+	for field, want := range expected {
+		got, ok := a.Field(field)
+		if !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply copies the fields set in patch onto the account.
+func (a *Account) Apply(patch Patch) {
+	if patch.Name != nil {
+		a.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		a.Email = *patch.Email
+	}
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ListFilter narrows and paginates an account listing. Cursor is the opaque
+// NextCursor of a previous Page.
+type ListFilter struct {
+	Name   string
+	Email  string
+	Cursor string
+	Limit  int
+}
+
+// Page is one page of an account listing, ordered by creation date.
+type Page struct {
+	Accounts   []Account
+	NextCursor string
 }
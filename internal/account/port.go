@@ -0,0 +1,13 @@
+package account
+
+import "context"
+
+type Repository interface {
+	Create(ctx context.Context, account *Account) error
+	FindByID(ctx context.Context, id string) (*Account, error)
+	List(ctx context.Context, filter ListFilter) (*Page, error)
+	// Update saves the account if its stored version still is account.Version, then bumps it.
+	Update(ctx context.Context, account *Account) error
+	// Delete removes the account if its stored version is expectedVersion (0 for any) and returns it.
+	Delete(ctx context.Context, id string, expectedVersion int64) (*Account, error)
+}
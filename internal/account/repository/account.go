@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ramk42/omi-backend-assignment/internal/account"
+	"github.com/ramk42/omi-backend-assignment/pkg/outbox"
+	"strings"
+	"time"
+)
+
+// uniqueViolation is the SQLSTATE raised when a unique constraint is violated.
+const uniqueViolation = "23505"
+
+type Account struct {
+	db *pgxpool.Pool
+}
+
+func NewAccountRepository(db *pgxpool.Pool) *Account {
+	return &Account{db: db}
+}
+
+func (r *Account) Create(ctx context.Context, acc *account.Account) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO accounts (id, name, email)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, updated_at, version
+	`
+
+	return outbox.WithinTx(timeoutCtx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(timeoutCtx, query, acc.ID, acc.Name, acc.Email).Scan(&acc.CreatedAt, &acc.UpdatedAt, &acc.Version)
+		if IsEmailConflict(err) {
+			return account.ErrEmailTaken
+		}
+		return err
+	})
+}
+
+func (r *Account) FindByID(ctx context.Context, id string) (*account.Account, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, name, email, created_at, updated_at, version
+		FROM accounts
+		WHERE id = $1
+	`
+
+	var acc account.Account
+	err := r.db.QueryRow(timeoutCtx, query, id).Scan(&acc.ID, &acc.Name, &acc.Email, &acc.CreatedAt, &acc.UpdatedAt, &acc.Version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, account.ErrAccountNotFound
+		}
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// List uses keyset pagination on (created_at, id) so pages stay stable while
+// accounts are being inserted.
+func (r *Account) List(ctx context.Context, filter account.ListFilter) (*account.Page, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query, args, err := ListQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(timeoutCtx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &account.Page{Accounts: make([]account.Account, 0, filter.Limit)}
+	for rows.Next() {
+		var acc account.Account
+		if err := rows.Scan(&acc.ID, &acc.Name, &acc.Email, &acc.CreatedAt, &acc.UpdatedAt, &acc.Version); err != nil {
+			return nil, err
+		}
+		page.Accounts = append(page.Accounts, acc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Accounts) > filter.Limit {
+		page.Accounts = page.Accounts[:filter.Limit]
+		last := page.Accounts[len(page.Accounts)-1]
+		page.NextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// ListQuery builds the query of a listing and its arguments. It selects one
+// account more than filter.Limit, to know whether there is a next page.
+func ListQuery(filter account.ListFilter) (string, []any, error) {
+	var conditions []string
+	var args []any
+	if filter.Name != "" {
+		// position() rather than ILIKE so that % and _ in the filter match literally
+		args = append(args, filter.Name)
+		conditions = append(conditions, fmt.Sprintf("position(lower($%d) in lower(name)) > 0", len(args)))
+	}
+	if filter.Email != "" {
+		args = append(args, filter.Email)
+		conditions = append(conditions, fmt.Sprintf("email = $%d", len(args)))
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, createdAt, id)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `SELECT id, name, email, created_at, updated_at, version FROM accounts`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit+1)
+	query += fmt.Sprintf(" ORDER BY created_at, id LIMIT $%d", len(args))
+	return query, args, nil
+}
+
+func (r *Account) Update(ctx context.Context, acc *account.Account) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE accounts
+		SET name = $2, email = $3, updated_at = now(), version = version + 1
+		WHERE id = $1 AND version = $4
+		RETURNING updated_at, version
+	`
+
+	return outbox.WithinTx(timeoutCtx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(timeoutCtx, query, acc.ID, acc.Name, acc.Email, acc.Version).Scan(&acc.UpdatedAt, &acc.Version)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return missingOrStale(timeoutCtx, tx, acc.ID)
+			}
+			if IsEmailConflict(err) {
+				return account.ErrEmailTaken
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+func (r *Account) Delete(ctx context.Context, id string, expectedVersion int64) (*account.Account, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM accounts
+		WHERE id = $1 AND ($2::bigint = 0 OR version = $2)
+		RETURNING id, name, email, created_at, updated_at, version
+	`
+
+	var acc account.Account
+	err := outbox.WithinTx(timeoutCtx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(timeoutCtx, query, id, expectedVersion).Scan(&acc.ID, &acc.Name, &acc.Email, &acc.CreatedAt, &acc.UpdatedAt, &acc.Version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return missingOrStale(timeoutCtx, tx, id)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// missingOrStale tells apart the two reasons a versioned write can match no row.
+func missingOrStale(ctx context.Context, tx pgx.Tx, id string) error {
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM accounts WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return account.ErrVersionMismatch
+	}
+	return account.ErrAccountNotFound
+}
+
+// IsEmailConflict reports whether err is a violation of the unique email
+// index, which the repository reports as account.ErrEmailTaken.
+func IsEmailConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "idx_accounts_email"
+}
+
+// EncodeCursor returns the opaque cursor of the page starting after the account
+// created at createdAt with id.
+func EncodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+// DecodeCursor returns the position encoded by EncodeCursor, failing with
+// account.ErrInvalidCursor on a cursor it did not encode.
+func DecodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", account.ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", account.ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, "", account.ErrInvalidCursor
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return time.Time{}, "", account.ErrInvalidCursor
+	}
+	return t, id, nil
+}
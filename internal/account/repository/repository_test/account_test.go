@@ -0,0 +1,102 @@
+package repository_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ramk42/omi-backend-assignment/internal/account"
+	"github.com/ramk42/omi-backend-assignment/internal/account/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	id := uuid.NewString()
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.FixedZone("CET", 3600))
+
+	gotCreatedAt, gotID, err := repository.DecodeCursor(repository.EncodeCursor(createdAt, id))
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(gotCreatedAt), "the position must keep nanoseconds, got %s", gotCreatedAt)
+	assert.Equal(t, id, gotID)
+}
+
+func TestDecodeCursor_Malformed(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := map[string]string{
+		"not base64":        "not a cursor!",
+		"no separator":      encode("2024-01-02T03:04:05Z"),
+		"malformed time":    encode("yesterday|" + uuid.NewString()),
+		"malformed id":      encode("2024-01-02T03:04:05Z|42"),
+		"truncated":         repository.EncodeCursor(time.Now(), uuid.NewString())[:40],
+		"empty after parts": encode("|"),
+	}
+	for name, cursor := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := repository.DecodeCursor(cursor)
+			assert.ErrorIs(t, err, account.ErrInvalidCursor)
+		})
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	id := uuid.NewString()
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := map[string]struct {
+		filter    account.ListFilter
+		wantQuery string
+		wantArgs  []any
+	}{
+		"unfiltered": {
+			filter:    account.ListFilter{Limit: 20},
+			wantQuery: `SELECT id, name, email, created_at, updated_at, version FROM accounts ORDER BY created_at, id LIMIT $1`,
+			wantArgs:  []any{21},
+		},
+		"name matched literally and case-insensitively": {
+			filter:    account.ListFilter{Name: "50%_off", Limit: 20},
+			wantQuery: `SELECT id, name, email, created_at, updated_at, version FROM accounts WHERE position(lower($1) in lower(name)) > 0 ORDER BY created_at, id LIMIT $2`,
+			wantArgs:  []any{"50%_off", 21},
+		},
+		"every filter after a cursor": {
+			filter: account.ListFilter{Name: "ada", Email: "ada@example.com", Cursor: repository.EncodeCursor(createdAt, id), Limit: 100},
+			wantQuery: `SELECT id, name, email, created_at, updated_at, version FROM accounts ` +
+				`WHERE position(lower($1) in lower(name)) > 0 AND email = $2 AND (created_at, id) > ($3, $4) ORDER BY created_at, id LIMIT $5`,
+			wantArgs: []any{"ada", "ada@example.com", createdAt, id, 101},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			query, args, err := repository.ListQuery(tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantQuery, query)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestListQuery_MalformedCursor(t *testing.T) {
+	_, _, err := repository.ListQuery(account.ListFilter{Cursor: "not a cursor!", Limit: 20})
+	assert.ErrorIs(t, err, account.ErrInvalidCursor)
+}
+
+func TestIsEmailConflict(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"unique email violation": {err: &pgconn.PgError{Code: "23505", ConstraintName: "idx_accounts_email"}, want: true},
+		"wrapped":                {err: fmt.Errorf("insert account: %w", &pgconn.PgError{Code: "23505", ConstraintName: "idx_accounts_email"}), want: true},
+		"other unique index":     {err: &pgconn.PgError{Code: "23505", ConstraintName: "accounts_pkey"}},
+		"other violation":        {err: &pgconn.PgError{Code: "23502", ConstraintName: "idx_accounts_email"}},
+		"not a postgres error":   {err: errors.New("connection reset by peer")},
+		"no error":               {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, repository.IsEmailConflict(tt.err))
+		})
+	}
+}
@@ -2,16 +2,143 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"github.com/google/uuid"
 	"github.com/ramk42/omi-backend-assignment/internal/account"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"strconv"
 )
 
-type Account struct{}
+type Account struct {
+	repository account.Repository
+}
+
+func NewAccount(accountRepo account.Repository) *Account {
+	return &Account{repository: accountRepo}
+}
+
+func (a *Account) Create(ctx context.Context, acc account.Account) (*account.Account, error) {
+	acc.Normalize()
+	if err := acc.Validate(); err != nil {
+		return nil, err
+	}
+	acc.ID = uuid.NewString()
+	draft := logsreporting.DraftFromContext(ctx)
+	draft.SetResourceID(acc.ID)
+	draft.SetChanges(auditChanges(account.Diff(nil, &acc)))
+	if err := a.repository.Create(ctx, &acc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+func (a *Account) Get(ctx context.Context, id string) (*account.Account, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, account.ErrInvalidAccountID
+	}
+	return a.repository.FindByID(ctx, id)
+}
+
+func (a *Account) List(ctx context.Context, filter account.ListFilter) (*account.Page, error) {
+	filter.Email = account.NormalizeEmail(filter.Email)
+	if filter.Limit <= 0 {
+		filter.Limit = account.DefaultPageLimit
+	}
+	if filter.Limit > account.MaxPageLimit {
+		filter.Limit = account.MaxPageLimit
+	}
+	return a.repository.List(ctx, filter)
+}
+
+// Patch applies the patch on the latest version of the account. Unconditional
+// patches are retried when a concurrent update wins the race.
+func (a *Account) Patch(ctx context.Context, id string, patch account.Patch) (*account.Mutation, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, account.ErrInvalidAccountID
+	}
+	patch.Normalize()
 
-func NewAccount() *Account {
-	return &Account{}
+	const maxAttempts = 3
+	for attempt := 1; ; attempt++ {
+		mutation, err := a.patch(ctx, id, patch)
+		if errors.Is(err, account.ErrVersionMismatch) && patch.Version == 0 && attempt < maxAttempts {
+			continue
+		}
+		return mutation, err
+	}
 }
 
-func (a *Account) Patch(ctx context.Context, account account.Account) error {
+func (a *Account) patch(ctx context.Context, id string, patch account.Patch) (*account.Mutation, error) {
+	current, err := a.repository.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Version != 0 && current.Version != patch.Version {
+		return nil, account.ErrVersionMismatch
+	}
+	if !current.Satisfies(patch.Expected) {
+		return nil, account.ErrPatchTestFailed
+	}
+
+	mutation := &account.Mutation{Before: *current, After: *current}
+	mutation.After.Apply(patch)
+	mutation.Changes = account.Diff(&mutation.Before, &mutation.After)
+	if len(mutation.Changes) == 0 {
+		logsreporting.DraftFromContext(ctx).MarkUnchanged()
+		return mutation, nil
+	}
+	if err := mutation.After.Validate(); err != nil {
+		return nil, err
+	}
+
+	// annotated before the write so the event recorded along with it is complete
+	draft := logsreporting.DraftFromContext(ctx)
+	draft.SetChanges(auditChanges(mutation.Changes))
+	draft.Annotate("version_before", strconv.FormatInt(mutation.Before.Version, 10))
+	draft.Annotate("version_after", strconv.FormatInt(mutation.Before.Version+1, 10))
+
+	if err := a.repository.Update(ctx, &mutation.After); err != nil {
+		return nil, err
+	}
+	return mutation, nil
+}
+
+// Delete removes the latest version of the account. Unconditional deletes are
+// retried when a concurrent update wins the race, so the audited state is the one deleted.
+func (a *Account) Delete(ctx context.Context, id string, expectedVersion int64) (*account.Account, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, account.ErrInvalidAccountID
+	}
+
+	const maxAttempts = 3
+	for attempt := 1; ; attempt++ {
+		deleted, err := a.delete(ctx, id, expectedVersion)
+		if errors.Is(err, account.ErrVersionMismatch) && expectedVersion == 0 && attempt < maxAttempts {
+			continue
+		}
+		return deleted, err
+	}
+}
+
+func (a *Account) delete(ctx context.Context, id string, expectedVersion int64) (*account.Account, error) {
+	current, err := a.repository.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != 0 && current.Version != expectedVersion {
+		return nil, account.ErrVersionMismatch
+	}
+
+	draft := logsreporting.DraftFromContext(ctx)
+	draft.SetChanges(auditChanges(account.Diff(current, nil)))
+	draft.Annotate("version_before", strconv.FormatInt(current.Version, 10))
+	return a.repository.Delete(ctx, id, current.Version)
+}
 
-	return nil
+func auditChanges(changes []account.Change) []logsreporting.Change {
+	auditChanges := make([]logsreporting.Change, 0, len(changes))
+	for _, change := range changes {
+		auditChanges = append(auditChanges, logsreporting.Change{Field: change.Field, Old: change.Old, New: change.New})
+	}
+	return auditChanges
 }
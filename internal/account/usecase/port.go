@@ -6,5 +6,9 @@ import (
 )
 
 type AccountPort interface {
-	Patch(ctx context.Context, account account.Account) error
+	Create(ctx context.Context, account account.Account) (*account.Account, error)
+	Get(ctx context.Context, id string) (*account.Account, error)
+	List(ctx context.Context, filter account.ListFilter) (*account.Page, error)
+	Patch(ctx context.Context, id string, patch account.Patch) (*account.Mutation, error)
+	Delete(ctx context.Context, id string, expectedVersion int64) (*account.Account, error)
 }
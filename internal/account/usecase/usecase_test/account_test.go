@@ -0,0 +1,252 @@
+package usecase_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/ramk42/omi-backend-assignment/internal/account"
+	"github.com/ramk42/omi-backend-assignment/internal/account/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// racyRepository bumps the version of the account right after it is read,
+// as a concurrent update would, for the given number of reads.
+type racyRepository struct {
+	account.Repository
+	stored  account.Account
+	missing bool
+	races   int
+	created []account.Account
+	updates []int64
+	deletes []int64
+	listed  []account.ListFilter
+}
+
+func (r *racyRepository) Create(_ context.Context, acc *account.Account) error {
+	r.created = append(r.created, *acc)
+	return nil
+}
+
+func (r *racyRepository) FindByID(_ context.Context, _ string) (*account.Account, error) {
+	if r.missing {
+		return nil, account.ErrAccountNotFound
+	}
+	acc := r.stored
+	if r.races > 0 {
+		r.races--
+		r.stored.Version++
+	}
+	return &acc, nil
+}
+
+func (r *racyRepository) List(_ context.Context, filter account.ListFilter) (*account.Page, error) {
+	r.listed = append(r.listed, filter)
+	return &account.Page{}, nil
+}
+
+func (r *racyRepository) Update(_ context.Context, acc *account.Account) error {
+	r.updates = append(r.updates, acc.Version)
+	if acc.Version != r.stored.Version {
+		return account.ErrVersionMismatch
+	}
+	r.stored = *acc
+	r.stored.Version++
+	return nil
+}
+
+func (r *racyRepository) Delete(_ context.Context, _ string, expectedVersion int64) (*account.Account, error) {
+	r.deletes = append(r.deletes, expectedVersion)
+	if expectedVersion != 0 && expectedVersion != r.stored.Version {
+		return nil, account.ErrVersionMismatch
+	}
+	deleted := r.stored
+	return &deleted, nil
+}
+
+func TestAccount_Delete(t *testing.T) {
+	tests := map[string]struct {
+		expectedVersion int64
+		races           int
+		wantErr         error
+		wantDeletes     []int64
+	}{
+		"unconditional without race":       {wantDeletes: []int64{1}},
+		"unconditional retried after race": {races: 1, wantDeletes: []int64{1, 2}},
+		"unconditional gives up":           {races: 3, wantErr: account.ErrVersionMismatch, wantDeletes: []int64{1, 2, 3}},
+		"conditional is not retried":       {expectedVersion: 1, races: 1, wantErr: account.ErrVersionMismatch, wantDeletes: []int64{1}},
+		"conditional on a stale version":   {expectedVersion: 5, wantErr: account.ErrVersionMismatch},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			id := uuid.NewString()
+			repo := &racyRepository{stored: account.Account{ID: id, Version: 1}, races: tt.races}
+
+			deleted, err := usecase.NewAccount(repo).Delete(context.Background(), id, tt.expectedVersion)
+			assert.Equal(t, tt.wantDeletes, repo.deletes)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, repo.stored.Version, deleted.Version)
+		})
+	}
+}
+
+// auditedContext returns a context carrying a draft, along with the changes
+// the draft ends up describing.
+func auditedContext() (context.Context, *logsreporting.Draft) {
+	draft := logsreporting.NewDraft("", func(resourceID, action string, changes []logsreporting.Change, reqCtx logsreporting.Context) *logsreporting.AuditLog {
+		return &logsreporting.AuditLog{Resource: logsreporting.Resource{ID: resourceID, Type: "account"}, Changes: changes}
+	})
+	return logsreporting.ContextWithDraft(context.Background(), draft), draft
+}
+
+func TestAccount_Create(t *testing.T) {
+	tests := map[string]struct {
+		acc         account.Account
+		want        account.Account
+		wantChanges []logsreporting.Change
+		wantErr     bool
+	}{
+		"normalized": {
+			acc:  account.Account{Name: "  Ada   Lovelace ", Email: " Ada@Example.com"},
+			want: account.Account{Name: "Ada Lovelace", Email: "ada@example.com"},
+			wantChanges: []logsreporting.Change{
+				{Field: "name", New: "Ada Lovelace"},
+				{Field: "email", New: "ada@example.com"},
+			},
+		},
+		"invalid": {
+			acc:     account.Account{Name: "Ada", Email: "not an email"},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := &racyRepository{}
+			ctx, draft := auditedContext()
+
+			created, err := usecase.NewAccount(repo).Create(ctx, tt.acc)
+			if tt.wantErr {
+				var validationErr *account.ValidationError
+				assert.ErrorAs(t, err, &validationErr)
+				assert.Empty(t, repo.created)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, uuid.Validate(created.ID))
+			tt.want.ID = created.ID
+			assert.Equal(t, tt.want, *created)
+			assert.Equal(t, []account.Account{tt.want}, repo.created)
+			event := draft.Event(nil)
+			assert.Equal(t, created.ID, event.Resource.ID)
+			assert.Equal(t, tt.wantChanges, event.Changes)
+		})
+	}
+}
+
+func TestAccount_Get(t *testing.T) {
+	id := uuid.NewString()
+	tests := map[string]struct {
+		id      string
+		missing bool
+		wantErr error
+	}{
+		"found":        {id: id},
+		"not found":    {id: id, missing: true, wantErr: account.ErrAccountNotFound},
+		"malformed id": {id: "42", wantErr: account.ErrInvalidAccountID},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := &racyRepository{stored: account.Account{ID: id, Name: "Ada", Version: 1}, missing: tt.missing}
+
+			acc, err := usecase.NewAccount(repo).Get(context.Background(), tt.id)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, repo.stored, *acc)
+		})
+	}
+}
+
+func TestAccount_Patch(t *testing.T) {
+	name := func(s string) *string { return &s }
+	tests := map[string]struct {
+		id            string
+		patch         account.Patch
+		missing       bool
+		races         int
+		wantErr       error
+		wantUpdates   []int64
+		wantName      string
+		wantUnchanged bool
+	}{
+		"unconditional without race":       {patch: account.Patch{Name: name(" Grace ")}, wantUpdates: []int64{1}, wantName: "Grace"},
+		"unconditional retried after race": {patch: account.Patch{Name: name("Grace")}, races: 1, wantUpdates: []int64{1, 2}, wantName: "Grace"},
+		"unconditional gives up":           {patch: account.Patch{Name: name("Grace")}, races: 3, wantErr: account.ErrVersionMismatch, wantUpdates: []int64{1, 2, 3}},
+		"conditional is not retried":       {patch: account.Patch{Name: name("Grace"), Version: 1}, races: 1, wantErr: account.ErrVersionMismatch, wantUpdates: []int64{1}},
+		"conditional on a stale version":   {patch: account.Patch{Name: name("Grace"), Version: 5}, wantErr: account.ErrVersionMismatch},
+		"failed precondition":              {patch: account.Patch{Name: name("Grace"), Expected: map[string]string{"name": "Alan"}}, wantErr: account.ErrPatchTestFailed},
+		"unchanged":                        {patch: account.Patch{Name: name("Ada")}, wantName: "Ada", wantUnchanged: true},
+		"not found":                        {patch: account.Patch{Name: name("Grace")}, missing: true, wantErr: account.ErrAccountNotFound},
+		"malformed id":                     {id: "42", patch: account.Patch{Name: name("Grace")}, wantErr: account.ErrInvalidAccountID},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			id := uuid.NewString()
+			repo := &racyRepository{
+				stored:  account.Account{ID: id, Name: "Ada", Email: "ada@example.com", Version: 1},
+				missing: tt.missing,
+				races:   tt.races,
+			}
+			if tt.id != "" {
+				id = tt.id
+			}
+			ctx, draft := auditedContext()
+
+			mutation, err := usecase.NewAccount(repo).Patch(ctx, id, tt.patch)
+			assert.Equal(t, tt.wantUpdates, repo.updates)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, mutation.After.Name)
+			assert.Equal(t, tt.wantUnchanged, draft.Unchanged())
+			if !tt.wantUnchanged {
+				assert.Equal(t, []account.Change{{Field: "name", Old: "Ada", New: tt.wantName}}, mutation.Changes)
+				assert.Equal(t, tt.wantName, repo.stored.Name)
+			}
+		})
+	}
+}
+
+func TestAccount_List(t *testing.T) {
+	tests := map[string]struct {
+		filter account.ListFilter
+		want   account.ListFilter
+	}{
+		"default limit":  {filter: account.ListFilter{}, want: account.ListFilter{Limit: account.DefaultPageLimit}},
+		"negative limit": {filter: account.ListFilter{Limit: -1}, want: account.ListFilter{Limit: account.DefaultPageLimit}},
+		"limit kept":     {filter: account.ListFilter{Limit: 50}, want: account.ListFilter{Limit: 50}},
+		"limit clamped":  {filter: account.ListFilter{Limit: 1000}, want: account.ListFilter{Limit: account.MaxPageLimit}},
+		"email normalized": {
+			filter: account.ListFilter{Name: "Ada", Email: " Ada@Example.com ", Limit: 10},
+			want:   account.ListFilter{Name: "Ada", Email: "ada@example.com", Limit: 10},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := &racyRepository{}
+
+			_, err := usecase.NewAccount(repo).List(context.Background(), tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, []account.ListFilter{tt.want}, repo.listed)
+		})
+	}
+}
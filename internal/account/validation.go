@@ -0,0 +1,112 @@
+package account
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxNameLength       = 100
+	MaxEmailLength      = 254
+	maxEmailLocalLength = 64
+)
+
+// FieldError describes why the value of a single field was rejected.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError is returned when one or more fields of an account are invalid.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return "invalid account: " + strings.Join(msgs, "; ")
+}
+
+// NormalizeName trims surrounding whitespace and collapses inner runs of whitespace.
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// NormalizeEmail trims surrounding whitespace and lowercases the address so
+// uniqueness does not depend on casing.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Normalize rewrites the fields of the account in their canonical form.
+func (a *Account) Normalize() {
+	a.Name = NormalizeName(a.Name)
+	a.Email = NormalizeEmail(a.Email)
+}
+
+// Normalize rewrites the fields set by the patch in their canonical form.
+func (p *Patch) Normalize() {
+	if p.Name != nil {
+		name := NormalizeName(*p.Name)
+		p.Name = &name
+	}
+	if p.Email != nil {
+		email := NormalizeEmail(*p.Email)
+		p.Email = &email
+	}
+}
+
+// Validate checks the fields of a normalized account.
+func (a *Account) Validate() error {
+	var errs []FieldError
+	if msg := validateName(a.Name); msg != "" {
+		errs = append(errs, FieldError{Field: "name", Message: msg})
+	}
+	if msg := validateEmail(a.Email); msg != "" {
+		errs = append(errs, FieldError{Field: "email", Message: msg})
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func validateName(name string) string {
+	switch {
+	case name == "":
+		return "is required"
+	case utf8.RuneCountInString(name) > MaxNameLength:
+		return fmt.Sprintf("must be at most %d characters", MaxNameLength)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+func validateEmail(email string) string {
+	if email == "" {
+		return "is required"
+	}
+	if len(email) > MaxEmailLength {
+		return fmt.Sprintf("must be at most %d characters", MaxEmailLength)
+	}
+	// ParseAddress also accepts "Name <addr>" forms, only a bare address is valid here
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "must be a valid email address"
+	}
+	local, domain, _ := strings.Cut(email, "@")
+	if len(local) > maxEmailLocalLength {
+		return fmt.Sprintf("local part must be at most %d characters", maxEmailLocalLength)
+	}
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "must be a valid email address"
+	}
+	return ""
+}
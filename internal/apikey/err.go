@@ -0,0 +1,16 @@
+package apikey
+
+import "errors"
+
+// Usecase errors
+var (
+	ErrServiceRequired = errors.New("api key service name is required")
+	ErrMalformedToken  = errors.New("api key token is malformed")
+	ErrTooManyAttempts = errors.New("too many failed attempts for this api key, try again later")
+)
+
+// Repository errors
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key is revoked")
+)
@@ -0,0 +1,28 @@
+package apikey
+
+import "time"
+
+// APIKey is a long-lived credential of a service calling the API.
+type APIKey struct {
+	ID string
+	// Service is the name of the calling service, it identifies the principal.
+	Service string
+	Tenant  string
+	Scopes  []string
+	// SecretHash is the argon2id hash of the secret, the secret itself is never stored.
+	SecretHash string
+	// PreviousSecretHash stays valid until PreviousSecretExpiresAt after a rotation,
+	// so callers can roll out the new secret without downtime.
+	PreviousSecretHash      string
+	PreviousSecretExpiresAt *time.Time
+	CreatedAt               time.Time
+	RotatedAt               *time.Time
+	RevokedAt               *time.Time
+}
+
+// Issued is an API key along with its plaintext token, only available when
+// the key is issued or rotated.
+type Issued struct {
+	Key   APIKey
+	Token string
+}
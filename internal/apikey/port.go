@@ -0,0 +1,15 @@
+package apikey
+
+import (
+	"context"
+	"time"
+)
+
+type Repository interface {
+	Create(ctx context.Context, key *APIKey) error
+	FindByID(ctx context.Context, id string) (*APIKey, error)
+	List(ctx context.Context) ([]APIKey, error)
+	// Rotate replaces the secret hash of an active key, the current one remains valid until previousExpiresAt.
+	Rotate(ctx context.Context, id, secretHash string, previousExpiresAt time.Time) (*APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ramk42/omi-backend-assignment/internal/apikey"
+	"github.com/ramk42/omi-backend-assignment/pkg/outbox"
+	"time"
+)
+
+const columns = `id, service, tenant, scopes, secret_hash, previous_secret_hash, previous_secret_expires_at, created_at, rotated_at, revoked_at`
+
+type APIKey struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyRepository(db *pgxpool.Pool) *APIKey {
+	return &APIKey{db: db}
+}
+
+func (r *APIKey) Create(ctx context.Context, key *apikey.APIKey) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO api_keys (id, service, tenant, scopes, secret_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+
+	return outbox.WithinTx(timeoutCtx, r.db, func(tx pgx.Tx) error {
+		return tx.QueryRow(timeoutCtx, query, key.ID, key.Service, key.Tenant, key.Scopes, key.SecretHash).Scan(&key.CreatedAt)
+	})
+}
+
+func (r *APIKey) FindByID(ctx context.Context, id string) (*apikey.APIKey, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	key, err := scanKey(r.db.QueryRow(timeoutCtx, `SELECT `+columns+` FROM api_keys WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+func (r *APIKey) List(ctx context.Context) ([]apikey.APIKey, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.Query(timeoutCtx, `SELECT `+columns+` FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []apikey.APIKey
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKey) Rotate(ctx context.Context, id, secretHash string, previousExpiresAt time.Time) (*apikey.APIKey, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE api_keys
+		SET previous_secret_hash = secret_hash,
+		    previous_secret_expires_at = $3,
+		    secret_hash = $2,
+		    rotated_at = now()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING ` + columns
+
+	var key *apikey.APIKey
+	err := outbox.WithinTx(timeoutCtx, r.db, func(tx pgx.Tx) error {
+		var err error
+		key, err = scanKey(tx.QueryRow(timeoutCtx, query, id, secretHash, previousExpiresAt))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return missingOrRevoked(timeoutCtx, tx, id)
+		}
+		return err
+	})
+	return key, err
+}
+
+func (r *APIKey) Revoke(ctx context.Context, id string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return outbox.WithinTx(timeoutCtx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(timeoutCtx, `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return missingOrRevoked(timeoutCtx, tx, id)
+		}
+		return nil
+	})
+}
+
+func missingOrRevoked(ctx context.Context, tx pgx.Tx, id string) error {
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return apikey.ErrAPIKeyRevoked
+	}
+	return apikey.ErrAPIKeyNotFound
+}
+
+func scanKey(row pgx.Row) (*apikey.APIKey, error) {
+	var key apikey.APIKey
+	var previousHash *string
+	err := row.Scan(
+		&key.ID,
+		&key.Service,
+		&key.Tenant,
+		&key.Scopes,
+		&key.SecretHash,
+		&previousHash,
+		&key.PreviousSecretExpiresAt,
+		&key.CreatedAt,
+		&key.RotatedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if previousHash != nil {
+		key.PreviousSecretHash = *previousHash
+	}
+	return &key, nil
+}
@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ramk42/omi-backend-assignment/internal/apikey"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"time"
+)
+
+// TokenPrefix starts every API key token, which tells them apart from JWTs.
+const TokenPrefix = "omi_"
+
+const secretLen = 32
+
+type APIKey struct {
+	repository    apikey.Repository
+	verifications *verifications
+}
+
+func NewAPIKey(apiKeyRepo apikey.Repository) *APIKey {
+	return &APIKey{repository: apiKeyRepo, verifications: newVerifications()}
+}
+
+// Issue creates a key for service. The returned token is the only copy of the secret.
+func (a *APIKey) Issue(ctx context.Context, service, tenant string, scopes []string) (*apikey.Issued, error) {
+	service = strings.TrimSpace(service)
+	if service == "" {
+		return nil, apikey.ErrServiceRequired
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	key := apikey.APIKey{ID: uuid.NewString(), Service: service, Tenant: tenant, Scopes: scopes}
+	secret, hash, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	key.SecretHash = hash
+
+	logsreporting.DraftFromContext(ctx).SetResourceID(key.ID)
+	if err := a.repository.Create(ctx, &key); err != nil {
+		return nil, err
+	}
+	return &apikey.Issued{Key: key, Token: formatToken(key.ID, secret)}, nil
+}
+
+func (a *APIKey) List(ctx context.Context) ([]apikey.APIKey, error) {
+	return a.repository.List(ctx)
+}
+
+// Rotate issues a new secret for the key. The current secret keeps working
+// for gracePeriod so callers can switch over.
+func (a *APIKey) Rotate(ctx context.Context, id string, gracePeriod time.Duration) (*apikey.Issued, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	secret, hash, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	logsreporting.DraftFromContext(ctx).SetAction("api_key.rotate")
+	key, err := a.repository.Rotate(ctx, id, hash, time.Now().Add(gracePeriod))
+	if err != nil {
+		return nil, err
+	}
+	a.verifications.forget(id)
+	return &apikey.Issued{Key: *key, Token: formatToken(key.ID, secret)}, nil
+}
+
+func (a *APIKey) Revoke(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return apikey.ErrAPIKeyNotFound
+	}
+	logsreporting.DraftFromContext(ctx).SetAction("api_key.revoke")
+	if err := a.repository.Revoke(ctx, id); err != nil {
+		return err
+	}
+	a.verifications.forget(id)
+	return nil
+}
+
+// Authenticate implements auth.Authenticator for API key tokens.
+//
+// Verifying a secret costs an argon2id hash, so the tokens verified in the
+// last verifiedTokenTTL are trusted without it, and a key whose secret was
+// guessed wrong maxFailedAttempts times within failedAttemptsSpan is not
+// verified until the span is over.
+func (a *APIKey) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+	id, secret, err := parseToken(token)
+	if err != nil {
+		return nil, errors.Join(auth.ErrInvalidCredentials, err)
+	}
+	now := time.Now()
+	if principal := a.verifications.lookup(token, now); principal != nil {
+		return principal, nil
+	}
+	if a.verifications.blocked(id, now) {
+		return nil, errors.Join(auth.ErrInvalidCredentials, apikey.ErrTooManyAttempts)
+	}
+
+	key, err := a.repository.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, apikey.ErrAPIKeyNotFound) {
+			return nil, errors.Join(auth.ErrInvalidCredentials, err)
+		}
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, errors.Join(auth.ErrInvalidCredentials, apikey.ErrAPIKeyRevoked)
+	}
+
+	valid, err := verifySecret(secret, key.SecretHash)
+	if err != nil {
+		return nil, err
+	}
+	// a token of the current secret is trusted until the cache expires, one of the previous until its grace period is over
+	expiresAt := now.Add(verifiedTokenTTL)
+	if !valid && key.PreviousSecretHash != "" && key.PreviousSecretExpiresAt != nil && now.Before(*key.PreviousSecretExpiresAt) {
+		valid, err = verifySecret(secret, key.PreviousSecretHash)
+		if err != nil {
+			return nil, err
+		}
+		if valid {
+			log.Ctx(ctx).Warn().Str("key_id", key.ID).Msg("api key authenticated with its previous secret")
+			expiresAt = *key.PreviousSecretExpiresAt
+		}
+	}
+	if !valid {
+		a.verifications.fail(key.ID, now)
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	principal := &auth.Principal{
+		ID:           key.Service,
+		Type:         auth.PrincipalService,
+		Tenant:       key.Tenant,
+		Scopes:       key.Scopes,
+		CredentialID: key.ID,
+	}
+	a.verifications.remember(token, principal, now, expiresAt)
+	return principal, nil
+}
+
+func newSecret() (string, string, error) {
+	raw := make([]byte, secretLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	hash, err := hashSecret(secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, hash, nil
+}
+
+// formatToken renders the token handed to the caller: omi_<key id>.<secret>.
+// The key id lets the secret be checked against a single hash.
+func formatToken(id, secret string) string {
+	return TokenPrefix + id + "." + secret
+}
+
+func parseToken(token string) (string, string, error) {
+	rest, ok := strings.CutPrefix(token, TokenPrefix)
+	if !ok {
+		return "", "", apikey.ErrMalformedToken
+	}
+	id, secret, ok := strings.Cut(rest, ".")
+	if !ok || secret == "" {
+		return "", "", apikey.ErrMalformedToken
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return "", "", apikey.ErrMalformedToken
+	}
+	return id, secret, nil
+}
@@ -0,0 +1,16 @@
+package usecase
+
+import (
+	"context"
+	"github.com/ramk42/omi-backend-assignment/internal/apikey"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"time"
+)
+
+type APIKeyPort interface {
+	auth.Authenticator
+	Issue(ctx context.Context, service, tenant string, scopes []string) (*apikey.Issued, error)
+	List(ctx context.Context) ([]apikey.APIKey, error)
+	Rotate(ctx context.Context, id string, gracePeriod time.Duration) (*apikey.Issued, error)
+	Revoke(ctx context.Context, id string) error
+}
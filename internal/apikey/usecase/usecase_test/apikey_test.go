@@ -0,0 +1,286 @@
+package usecase_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/ramk42/omi-backend-assignment/internal/apikey"
+	"github.com/ramk42/omi-backend-assignment/internal/apikey/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryRepository keeps the keys in memory, as the Postgres repository would store them.
+type memoryRepository struct {
+	keys  map[string]*apikey.APIKey
+	finds int
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{keys: map[string]*apikey.APIKey{}}
+}
+
+func (r *memoryRepository) Create(_ context.Context, key *apikey.APIKey) error {
+	stored := *key
+	r.keys[key.ID] = &stored
+	return nil
+}
+
+func (r *memoryRepository) FindByID(_ context.Context, id string) (*apikey.APIKey, error) {
+	r.finds++
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	found := *key
+	return &found, nil
+}
+
+func (r *memoryRepository) List(_ context.Context) ([]apikey.APIKey, error) {
+	keys := make([]apikey.APIKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (r *memoryRepository) Rotate(_ context.Context, id, secretHash string, previousExpiresAt time.Time) (*apikey.APIKey, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	if key.RevokedAt != nil {
+		return nil, apikey.ErrAPIKeyRevoked
+	}
+	now := time.Now()
+	key.PreviousSecretHash, key.PreviousSecretExpiresAt = key.SecretHash, &previousExpiresAt
+	key.SecretHash, key.RotatedAt = secretHash, &now
+	rotated := *key
+	return &rotated, nil
+}
+
+func (r *memoryRepository) Revoke(_ context.Context, id string) error {
+	key, ok := r.keys[id]
+	if !ok {
+		return apikey.ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return nil
+}
+
+func issue(t *testing.T, repo *memoryRepository) (*usecase.APIKey, *apikey.Issued) {
+	keys := usecase.NewAPIKey(repo)
+	issued, err := keys.Issue(context.Background(), " billing ", "acme", []string{"accounts:read"})
+	require.NoError(t, err)
+	return keys, issued
+}
+
+func TestAPIKey_Issue(t *testing.T) {
+	repo := newMemoryRepository()
+	keys, issued := issue(t, repo)
+
+	assert.Equal(t, "billing", issued.Key.Service)
+	assert.True(t, strings.HasPrefix(issued.Token, usecase.TokenPrefix+issued.Key.ID+"."))
+	stored := repo.keys[issued.Key.ID]
+	assert.True(t, strings.HasPrefix(stored.SecretHash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+	assert.NotContains(t, stored.SecretHash, strings.TrimPrefix(issued.Token, usecase.TokenPrefix+issued.Key.ID+"."))
+
+	principal, err := keys.Authenticate(context.Background(), issued.Token)
+	require.NoError(t, err)
+	assert.Equal(t, &auth.Principal{
+		ID:           "billing",
+		Type:         auth.PrincipalService,
+		Tenant:       "acme",
+		Scopes:       []string{"accounts:read"},
+		CredentialID: issued.Key.ID,
+	}, principal)
+}
+
+func TestAPIKey_IssueRequiresService(t *testing.T) {
+	_, err := usecase.NewAPIKey(newMemoryRepository()).Issue(context.Background(), "  ", "", nil)
+	assert.ErrorIs(t, err, apikey.ErrServiceRequired)
+}
+
+func TestAPIKey_AuthenticateRejects(t *testing.T) {
+	repo := newMemoryRepository()
+	keys, issued := issue(t, repo)
+	secret := strings.TrimPrefix(issued.Token, usecase.TokenPrefix+issued.Key.ID+".")
+
+	tests := map[string]struct {
+		token   string
+		wantErr error
+	}{
+		"wrong secret":     {token: usecase.TokenPrefix + issued.Key.ID + ".not-the-secret", wantErr: auth.ErrInvalidCredentials},
+		"unknown key":      {token: usecase.TokenPrefix + uuid.NewString() + "." + secret, wantErr: apikey.ErrAPIKeyNotFound},
+		"missing prefix":   {token: issued.Key.ID + "." + secret, wantErr: apikey.ErrMalformedToken},
+		"missing dot":      {token: usecase.TokenPrefix + issued.Key.ID + secret, wantErr: apikey.ErrMalformedToken},
+		"empty secret":     {token: usecase.TokenPrefix + issued.Key.ID + ".", wantErr: apikey.ErrMalformedToken},
+		"id is not a uuid": {token: usecase.TokenPrefix + "billing." + secret, wantErr: apikey.ErrMalformedToken},
+		"empty":            {token: "", wantErr: apikey.ErrMalformedToken},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			principal, err := keys.Authenticate(context.Background(), tt.token)
+			assert.Nil(t, principal)
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestAPIKey_AuthenticateMalformedHash(t *testing.T) {
+	tests := map[string]string{
+		"not phc":             "plain-sha256-digest",
+		"other algorithm":     "$argon2i$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA",
+		"unsupported version": "$argon2id$v=16$m=19456,t=2,p=1$c2FsdA$aGFzaA",
+		"bad parameters":      "$argon2id$v=19$m=lots,t=2,p=1$c2FsdA$aGFzaA",
+		"bad salt":            "$argon2id$v=19$m=19456,t=2,p=1$!!!$aGFzaA",
+		"bad hash":            "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$!!!",
+		"missing hash":        "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA",
+	}
+	for name, hash := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newMemoryRepository()
+			keys, issued := issue(t, repo)
+			repo.keys[issued.Key.ID].SecretHash = hash
+
+			principal, err := keys.Authenticate(context.Background(), issued.Token)
+			assert.Nil(t, principal)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAPIKey_Rotate(t *testing.T) {
+	tests := map[string]struct {
+		gracePeriod  time.Duration
+		previousWork bool
+	}{
+		"within grace period":  {gracePeriod: time.Hour, previousWork: true},
+		"grace period expired": {gracePeriod: -time.Second},
+		"no grace period":      {gracePeriod: 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newMemoryRepository()
+			keys, issued := issue(t, repo)
+
+			rotated, err := keys.Rotate(context.Background(), issued.Key.ID, tt.gracePeriod)
+			require.NoError(t, err)
+			assert.NotEqual(t, issued.Token, rotated.Token)
+
+			_, err = keys.Authenticate(context.Background(), rotated.Token)
+			require.NoError(t, err)
+
+			_, err = keys.Authenticate(context.Background(), issued.Token)
+			if tt.previousWork {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+			}
+		})
+	}
+}
+
+func TestAPIKey_Revoke(t *testing.T) {
+	repo := newMemoryRepository()
+	keys, issued := issue(t, repo)
+	rotated, err := keys.Rotate(context.Background(), issued.Key.ID, time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, keys.Revoke(context.Background(), issued.Key.ID))
+
+	for name, token := range map[string]string{"current secret": rotated.Token, "previous secret": issued.Token} {
+		t.Run(name, func(t *testing.T) {
+			principal, err := keys.Authenticate(context.Background(), token)
+			assert.Nil(t, principal)
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+			assert.ErrorIs(t, err, apikey.ErrAPIKeyRevoked)
+		})
+	}
+
+	_, err = keys.Rotate(context.Background(), issued.Key.ID, time.Hour)
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyRevoked)
+}
+
+func TestAPIKey_RejectsInvalidIDs(t *testing.T) {
+	keys := usecase.NewAPIKey(newMemoryRepository())
+
+	_, err := keys.Rotate(context.Background(), "not-a-uuid", time.Hour)
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyNotFound)
+	assert.ErrorIs(t, keys.Revoke(context.Background(), "not-a-uuid"), apikey.ErrAPIKeyNotFound)
+}
+
+func TestAPIKey_AuthenticateCachesVerifiedTokens(t *testing.T) {
+	repo := newMemoryRepository()
+	keys, issued := issue(t, repo)
+	first, err := keys.Authenticate(context.Background(), issued.Token)
+	require.NoError(t, err)
+
+	// neither looked up nor hashed again
+	repo.keys[issued.Key.ID].SecretHash = "not a hash"
+	second, err := keys.Authenticate(context.Background(), issued.Token)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, repo.finds)
+
+	// a token of another secret of the same key is verified
+	_, err = keys.Authenticate(context.Background(), usecase.TokenPrefix+issued.Key.ID+".other-secret")
+	assert.Error(t, err)
+	assert.Equal(t, 2, repo.finds)
+}
+
+func TestAPIKey_ChangesInvalidateVerifiedTokens(t *testing.T) {
+	tests := map[string]func(keys *usecase.APIKey, id string) error{
+		"rotate": func(keys *usecase.APIKey, id string) error {
+			_, err := keys.Rotate(context.Background(), id, 0)
+			return err
+		},
+		"revoke": func(keys *usecase.APIKey, id string) error {
+			return keys.Revoke(context.Background(), id)
+		},
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			keys, issued := issue(t, newMemoryRepository())
+			_, err := keys.Authenticate(context.Background(), issued.Token)
+			require.NoError(t, err)
+
+			require.NoError(t, change(keys, issued.Key.ID))
+			_, err = keys.Authenticate(context.Background(), issued.Token)
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestAPIKey_LimitsFailedVerifications(t *testing.T) {
+	repo := newMemoryRepository()
+	keys, issued := issue(t, repo)
+	cached, err := keys.Issue(context.Background(), "billing", "acme", nil)
+	require.NoError(t, err)
+	_, err = keys.Authenticate(context.Background(), cached.Token)
+	require.NoError(t, err)
+
+	for _, key := range []*apikey.Issued{issued, cached} {
+		for range 10 {
+			_, err := keys.Authenticate(context.Background(), usecase.TokenPrefix+key.Key.ID+".guess")
+			require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+			require.NotErrorIs(t, err, apikey.ErrTooManyAttempts)
+		}
+	}
+
+	// the key is no longer looked up nor hashed, even for its right secret
+	finds := repo.finds
+	_, err = keys.Authenticate(context.Background(), issued.Token)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	assert.ErrorIs(t, err, apikey.ErrTooManyAttempts)
+	assert.Equal(t, finds, repo.finds)
+
+	// the callers already verified are not locked out
+	_, err = keys.Authenticate(context.Background(), cached.Token)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"sync"
+	"time"
+)
+
+const (
+	// verifiedTokenTTL is how long a verified token is trusted without hashing
+	// it again. It bounds how long a key rotated or revoked by another instance
+	// keeps working on this one.
+	verifiedTokenTTL   = 30 * time.Second
+	maxVerifiedTokens  = 10000
+	maxFailedAttempts  = 10
+	failedAttemptsSpan = time.Minute
+)
+
+type verifiedToken struct {
+	principal *auth.Principal
+	expiresAt time.Time
+}
+
+type failedAttempts struct {
+	count int
+	since time.Time
+}
+
+// verifications spares the argon2id hashing of API key secrets: the tokens
+// verified recently are cached, keyed by their SHA-256 so that the secrets are
+// not kept in memory, and the keys whose secret was guessed wrong too many
+// times are not verified for a while.
+type verifications struct {
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]verifiedToken
+	failed   map[string]*failedAttempts
+}
+
+func newVerifications() *verifications {
+	return &verifications{verified: map[[sha256.Size]byte]verifiedToken{}, failed: map[string]*failedAttempts{}}
+}
+
+// lookup returns the principal of a token verified recently, nil otherwise.
+func (v *verifications) lookup(token string, now time.Time) *auth.Principal {
+	sum := sha256.Sum256([]byte(token))
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	verified, ok := v.verified[sum]
+	if !ok {
+		return nil
+	}
+	if now.After(verified.expiresAt) {
+		delete(v.verified, sum)
+		return nil
+	}
+	principal := *verified.principal
+	return &principal
+}
+
+// remember caches a verified token until expiresAt, at most verifiedTokenTTL.
+func (v *verifications) remember(token string, principal *auth.Principal, now, expiresAt time.Time) {
+	if ttl := now.Add(verifiedTokenTTL); ttl.Before(expiresAt) {
+		expiresAt = ttl
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.failed, principal.CredentialID)
+	if len(v.verified) >= maxVerifiedTokens {
+		for sum, verified := range v.verified {
+			if now.After(verified.expiresAt) {
+				delete(v.verified, sum)
+			}
+		}
+		if len(v.verified) >= maxVerifiedTokens {
+			return
+		}
+	}
+	cached := *principal
+	v.verified[sha256.Sum256([]byte(token))] = verifiedToken{principal: &cached, expiresAt: expiresAt}
+}
+
+// forget drops the cached tokens of a key, once rotated or revoked.
+func (v *verifications) forget(keyID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for sum, verified := range v.verified {
+		if verified.principal.CredentialID == keyID {
+			delete(v.verified, sum)
+		}
+	}
+}
+
+// blocked reports whether the secret of a key was guessed wrong too many times lately.
+func (v *verifications) blocked(keyID string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	failed, ok := v.failed[keyID]
+	if !ok {
+		return false
+	}
+	if now.Sub(failed.since) > failedAttemptsSpan {
+		delete(v.failed, keyID)
+		return false
+	}
+	return failed.count >= maxFailedAttempts
+}
+
+// fail records a wrong secret for a key. Only existing keys are recorded, so
+// that the failures cannot grow past the number of keys.
+func (v *verifications) fail(keyID string, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	failed, ok := v.failed[keyID]
+	if !ok || now.Sub(failed.since) > failedAttemptsSpan {
+		v.failed[keyID] = &failedAttempts{count: 1, since: now}
+		return
+	}
+	failed.count++
+}
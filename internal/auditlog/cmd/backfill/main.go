@@ -0,0 +1,41 @@
+// Command backfill upcasts the audit logs recorded with an older spec_version
+// into the current one, e.g. the legacy resource shape, whose attributes hold
+// the request body as a JSON string, into the structured shape the JSON
+// operators of Postgres can query.
+package main
+
+import (
+	"context"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog/repository"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/database"
+	"github.com/ramk42/omi-backend-assignment/pkg/env"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db := database.New(ctx, env.MustGetEnv[string]("DATABASE_URL"))
+	defer db.Close()
+
+	redactionFile := env.MustGetEnv[string]("REDACTION_POLICY_FILE")
+	redaction, err := redact.LoadFile(redactionFile, []byte(env.GetEnv("REDACTION_HMAC_KEY", "")))
+	if err != nil {
+		log.Fatal().Err(err).Str("path", redactionFile).Msg("failed to load redaction policy")
+	}
+
+	backfill := usecase.NewBackfill(repository.NewAuditEventRepository(db), redaction, env.GetEnv("BACKFILL_BATCH_SIZE", 500))
+	rewritten, err := backfill.Run(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Int("rewritten", rewritten).Msg("backfill interrupted, run it again to resume")
+	}
+	log.Info().Int("rewritten", rewritten).Msg("backfill completed")
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/ramk42/omi-backend-assignment/internal/auditlog/usecase"
 	"github.com/ramk42/omi-backend-assignment/pkg/database"
 	"github.com/ramk42/omi-backend-assignment/pkg/env"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
 	"github.com/ramk42/omi-backend-assignment/pkg/natsclient"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"os"
@@ -29,7 +31,8 @@ func main() {
 		<-sig
 		log.Info().Msg("shutdown signal received - Starting graceful shutdown...")
 		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, _ := context.WithTimeout(ctx, 30*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
 
 		go func() {
 			<-shutdownCtx.Done()
@@ -56,7 +59,16 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Str("nats_url", natsURL).Msg("failed to connect to nats")
 	}
-	auditLogConsumer := consumer.NewAuditLog(auditLogUsecase, conn)
+	redactionFile := env.MustGetEnv[string]("REDACTION_POLICY_FILE")
+	redaction, err := redact.LoadFile(redactionFile, []byte(env.GetEnv("REDACTION_HMAC_KEY", "")))
+	if err != nil {
+		log.Fatal().Err(err).Str("path", redactionFile).Msg("failed to load redaction policy")
+	}
+	subjects, err := logsreporting.ParseSubjectTemplate(env.GetEnv("AUDIT_SUBJECT_TEMPLATE", logsreporting.DefaultSubjectTemplate))
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid audit subject template")
+	}
+	auditLogConsumer := consumer.NewAuditLog(auditLogUsecase, conn, redaction, repository.NewRejectionRepository(db), subjects)
 	err = auditLogConsumer.Start(ctx)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to start audit log consumer")
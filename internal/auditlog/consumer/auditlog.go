@@ -2,10 +2,11 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"github.com/nats-io/nats.go"
 	"github.com/ramk42/omi-backend-assignment/internal/auditlog"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
 	"github.com/rs/zerolog/log"
 	"time"
 )
@@ -13,20 +14,38 @@ import (
 type AuditLog struct {
 	auditLogUsecase auditlog.Usecase
 	natsConn        *nats.Conn
+	redaction       *redact.Policy
+	rejections      auditlog.RejectionRepository
+	subjects        logsreporting.SubjectTemplate
 }
 
-func NewAuditLog(auditEventRepo auditlog.Usecase, natsConn *nats.Conn) *AuditLog {
-	return &AuditLog{auditLogUsecase: auditEventRepo, natsConn: natsConn}
+// NewAuditLog consumes the events published on the subjects of the template,
+// which must be the one of the producers.
+func NewAuditLog(auditEventRepo auditlog.Usecase, natsConn *nats.Conn, redaction *redact.Policy, rejections auditlog.RejectionRepository, subjects logsreporting.SubjectTemplate) *AuditLog {
+	return &AuditLog{auditLogUsecase: auditEventRepo, natsConn: natsConn, redaction: redaction, rejections: rejections, subjects: subjects}
 }
 
 func (a *AuditLog) Start(ctx context.Context) error {
-	sub, err := a.natsConn.QueueSubscribe("audit_logs", "audit_workers", func(msg *nats.Msg) {
-		var event *auditlog.Model
-		err := json.Unmarshal(msg.Data, &event)
+	handler := func(msg *nats.Msg) {
+		// structured and binary CloudEvents as well as the legacy AuditLog JSON
+		decoded, err := logsreporting.DecodeMessage(msg)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to unmarshal audit event")
+			a.reject(ctx, msg, nil, auditlog.RejectionReasonDecode, err)
 			return
 		}
+		if err := logsreporting.ValidateSchema(decoded); err != nil {
+			a.reject(ctx, msg, decoded, auditlog.RejectionReasonSchema, err)
+			return
+		}
+		// producers of previous releases still send events of older spec_versions
+		upcast, err := logsreporting.UpcastEvent(decoded)
+		if err != nil {
+			a.reject(ctx, msg, decoded, auditlog.RejectionReasonSchema, err)
+			return
+		}
+		event := (*auditlog.Model)(upcast)
+		// producers redact already, this catches any that are misconfigured or outdated
+		a.redaction.Event((*logsreporting.AuditLog)(event))
 		err = a.auditLogUsecase.Push(ctx, event)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to push audit event to usecase")
@@ -35,14 +54,22 @@ func (a *AuditLog) Start(ctx context.Context) error {
 			}
 			return
 		}
-	})
-	if err != nil {
-		log.Error().Err(err).Msg("failed to subscribe to NATS topic")
-		return err
 	}
-	defer sub.Unsubscribe()
+	subjects := []string{a.subjects.Wildcard()}
+	if subjects[0] != logsreporting.LegacySubject {
+		// producers of previous releases still publish on the legacy subject
+		subjects = append(subjects, logsreporting.LegacySubject)
+	}
+	for _, subject := range subjects {
+		sub, err := a.natsConn.QueueSubscribe(subject, "audit_workers", handler)
+		if err != nil {
+			log.Error().Err(err).Str("subject", subject).Msg("failed to subscribe to NATS topic")
+			return err
+		}
+		defer sub.Unsubscribe()
+		log.Info().Str("subject", subject).Msg("subscribed to NATS topic")
+	}
 
-	log.Info().Msg("subscribed to NATS topic")
 	select {
 	case <-ctx.Done():
 		log.Info().Msg("application shutting down, stopping audit log consumer")
@@ -51,6 +78,16 @@ func (a *AuditLog) Start(ctx context.Context) error {
 	}
 }
 
+// reject stores the message, redacted, so that it is not lost, along with the
+// validation errors when it does not match the schema.
+func (a *AuditLog) reject(ctx context.Context, msg *nats.Msg, decoded *logsreporting.AuditLog, reason string, err error) {
+	rejection := NewRejection(msg, decoded, a.redaction, reason, err)
+	log.Error().Err(err).Str("event_id", rejection.EventID).Str("reason", reason).Msg("rejecting audit event")
+	if err := a.rejections.Reject(ctx, rejection); err != nil {
+		log.Error().Err(err).Str("event_id", rejection.EventID).Msg("failed to store rejected audit event")
+	}
+}
+
 func (a *AuditLog) retryUntilBufferAvailable(ctx context.Context, event *auditlog.Model) {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
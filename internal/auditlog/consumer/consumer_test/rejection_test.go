@@ -0,0 +1,103 @@
+package consumer_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog/consumer"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func loadPolicy(t *testing.T) *redact.Policy {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"resources": {"account": [
+	  {"path": "email", "strategy": "hash"},
+	  {"path": "password", "strategy": "drop"}
+	]}}`), 0o600))
+	policy, err := redact.LoadFile(path, []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	return policy
+}
+
+func TestNewRejection_RedactsDecodedEvents(t *testing.T) {
+	var attributes any
+	require.NoError(t, json.Unmarshal([]byte(`{"email":"jane@example.com","password":"hunter2"}`), &attributes))
+	// the action is missing, so that the event does not match its schema
+	event := &logsreporting.AuditLog{
+		ID:          "11111111-1111-1111-1111-111111111111",
+		SpecVersion: logsreporting.SpecVersion,
+		Type:        logsreporting.EventTypeChange,
+		Source:      "backend.api",
+		Timestamp:   time.Now().UTC(),
+		Actor:       logsreporting.Actor{Type: "user", ID: "bob"},
+		Resource:    logsreporting.Resource{ID: "42", Type: "account", Attributes: attributes},
+		Changes:     []logsreporting.Change{{Field: "email", Old: "jane@example.com", New: "doe@example.com"}},
+	}
+	tests := map[string]logsreporting.Encoding{
+		"legacy":          {ContentMode: logsreporting.ContentModeLegacy},
+		"structured":      {ContentMode: logsreporting.ContentModeStructured},
+		"binary":          {ContentMode: logsreporting.ContentModeBinary},
+		"binary protobuf": {ContentMode: logsreporting.ContentModeBinary, Format: logsreporting.FormatProtobuf},
+	}
+	for name, encoding := range tests {
+		t.Run(name, func(t *testing.T) {
+			msg, err := logsreporting.EncodeMessage("audit.acme.http_request.account.delete", event, encoding)
+			require.NoError(t, err)
+			decoded, err := logsreporting.DecodeMessage(msg)
+			require.NoError(t, err)
+			schemaErr := logsreporting.ValidateSchema(decoded)
+			require.Error(t, schemaErr)
+
+			rejection := consumer.NewRejection(msg, decoded, loadPolicy(t), auditlog.RejectionReasonSchema, schemaErr)
+			assert.Equal(t, event.ID, rejection.EventID)
+			assert.Equal(t, msg.Subject, rejection.Subject)
+			assert.NotEmpty(t, rejection.Errors)
+			payload := string(rejection.Payload)
+			assert.NotContains(t, payload, "jane@example.com")
+			assert.NotContains(t, payload, "hunter2")
+			assert.Contains(t, payload, `"email":"hmac-sha256:`)
+
+			// the stored message can be replayed
+			replayed, err := logsreporting.DecodeMessage(&nats.Msg{Subject: rejection.Subject, Header: rejection.Header, Data: rejection.Payload})
+			require.NoError(t, err)
+			assert.Equal(t, event.ID, replayed.ID)
+			assert.Equal(t, event.Resource.ID, replayed.Resource.ID)
+		})
+	}
+}
+
+func TestNewRejection_RedactsLegacyResources(t *testing.T) {
+	msg := &nats.Msg{Subject: logsreporting.LegacySubject, Data: []byte(`{"id":"11111111-1111-1111-1111-111111111111",
+		"spec_version":"1.0","source":"backend.api","actor":{"id":"bob"},"resource":{"id":"42","type":"account",
+		"attributes":{"id":"42","type":"account","attributes":"{\"email\":\"jane@example.com\",\"password\":\"hunter2\"}"}}}`)}
+	decoded, err := logsreporting.DecodeMessage(msg)
+	require.NoError(t, err)
+
+	rejection := consumer.NewRejection(msg, decoded, loadPolicy(t), auditlog.RejectionReasonSchema, errors.New("rejected"))
+	payload := string(rejection.Payload)
+	assert.NotContains(t, payload, "jane@example.com")
+	assert.NotContains(t, payload, "hunter2")
+	assert.Contains(t, payload, `"email":"hmac-sha256:`)
+}
+
+func TestNewRejection_KeepsOnlyDigestOfUndecodableMessages(t *testing.T) {
+	msg := &nats.Msg{Subject: logsreporting.LegacySubject, Data: []byte(`{"email":"jane@example.com"`)}
+	_, err := logsreporting.DecodeMessage(msg)
+	require.Error(t, err)
+
+	rejection := consumer.NewRejection(msg, nil, loadPolicy(t), auditlog.RejectionReasonDecode, err)
+	sum := sha256.Sum256(msg.Data)
+	assert.JSONEq(t, `{"sha256":"`+hex.EncodeToString(sum[:])+`","size":27}`, string(rejection.Payload))
+	assert.Empty(t, rejection.EventID)
+	assert.Equal(t, []string{err.Error()}, rejection.Errors)
+}
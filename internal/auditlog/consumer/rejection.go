@@ -0,0 +1,74 @@
+package consumer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
+	"strings"
+	"time"
+)
+
+// NewRejection describes a message the consumer refused without keeping the
+// personal data it may carry. A decoded event is stored redacted, re-encoded
+// as AuditLog JSON so that it can be replayed once fixed, and the headers of
+// its original encoding are left out. A message that could not be decoded
+// cannot be redacted: only the SHA-256 digest and size of its payload are kept.
+func NewRejection(msg *nats.Msg, decoded *logsreporting.AuditLog, redaction *redact.Policy, reason string, err error) *auditlog.Rejection {
+	errs := []string{err.Error()}
+	var schemaErr *logsreporting.SchemaError
+	if errors.As(err, &schemaErr) {
+		errs = schemaErr.Errors
+	}
+	rejection := &auditlog.Rejection{
+		Subject:    msg.Subject,
+		Header:     msg.Header,
+		Reason:     reason,
+		Errors:     errs,
+		ReceivedAt: time.Now().UTC(),
+	}
+	if decoded != nil {
+		rejection.EventID = decoded.ID
+		if payload, ok := redactedPayload(decoded, redaction); ok {
+			rejection.Header = withoutEncodingHeaders(msg.Header)
+			rejection.Payload = payload
+			return rejection
+		}
+	}
+	rejection.Payload = digest(msg.Data)
+	return rejection
+}
+
+func redactedPayload(event *logsreporting.AuditLog, redaction *redact.Policy) ([]byte, bool) {
+	// the rules apply to the structured resource, the one of the current spec_version
+	event.Resource.Upgrade()
+	redaction.Event(event)
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, false
+	}
+	return payload, true
+}
+
+// withoutEncodingHeaders drops the headers of the CloudEvents encodings, which
+// no longer describe a payload re-encoded as AuditLog JSON.
+func withoutEncodingHeaders(header nats.Header) nats.Header {
+	kept := nats.Header{}
+	for key, values := range header {
+		if strings.EqualFold(key, "Content-Type") || strings.HasPrefix(strings.ToLower(key), "ce-") {
+			continue
+		}
+		kept[key] = values
+	}
+	return kept
+}
+
+func digest(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	payload, _ := json.Marshal(map[string]any{"sha256": hex.EncodeToString(sum[:]), "size": len(data)})
+	return payload
+}
@@ -13,4 +13,5 @@ var (
 // ErrDatabaseUnavailable Repository errors
 var (
 	ErrDatabaseUnavailable = errors.New("database is not accessible")
+	ErrAuditLogNotFound    = errors.New("audit log not found")
 )
@@ -1,5 +1,29 @@
 package auditlog
 
-import "github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+import (
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"time"
+)
 
 type Model logsreporting.AuditLog
+
+// Rejection reasons
+const (
+	// RejectionReasonDecode is the reason of a message that could not be decoded in any encoding.
+	RejectionReasonDecode = "decode"
+	// RejectionReasonSchema is the reason of an event that does not match its JSON Schema.
+	RejectionReasonSchema = "schema"
+)
+
+// Rejection is a message the consumer refused, kept redacted along with why so
+// that it can be inspected and replayed once fixed.
+type Rejection struct {
+	// EventID is the id of the event, empty when the message could not be decoded.
+	EventID    string
+	Subject    string
+	Header     map[string][]string
+	Payload    []byte
+	Reason     string
+	Errors     []string
+	ReceivedAt time.Time
+}
@@ -6,7 +6,28 @@ type Repository interface {
 	Insert(ctx context.Context, events []*Model) error
 }
 
+// Reader reads the stored events.
+type Reader interface {
+	// FindByID returns the event of id, upcast into the current spec_version.
+	FindByID(ctx context.Context, id string) (*Model, error)
+}
+
 type Usecase interface {
 	Push(ctx context.Context, model *Model) error
 	Close()
 }
+
+// BackfillRepository rewrites the stored events recorded with an older spec_version.
+type BackfillRepository interface {
+	// Outdated returns up to limit events ordered by id, after the event of id
+	// after (from the start when empty), whose spec_version is not the current
+	// one. They are returned as stored, not upcast.
+	Outdated(ctx context.Context, after string, limit int) ([]*Model, error)
+	// Update rewrites the stored events, all fields but their id.
+	Update(ctx context.Context, events []*Model) error
+}
+
+// RejectionRepository stores the messages the consumer refused.
+type RejectionRepository interface {
+	Reject(ctx context.Context, rejection *Rejection) error
+}
@@ -3,11 +3,13 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ramk42/omi-backend-assignment/internal/auditlog"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
 	"github.com/rs/zerolog/log"
 	"time"
 )
@@ -28,8 +30,9 @@ func (r *AuditLog) Insert(ctx context.Context, events []*auditlog.Model) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	query := `
-		INSERT INTO audit_logs (id, spec_version, source, type, subject, timestamp, actor, action, resource, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO audit_logs (id, spec_version, source, type, subject, timestamp, actor, action, resource, metadata, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO NOTHING
 	`
 
 	batch := &pgx.Batch{}
@@ -50,7 +53,8 @@ func (r *AuditLog) Insert(ctx context.Context, events []*auditlog.Model) error {
 			event.Actor,
 			event.Action,
 			event.Resource,
-			event.Metadata,
+			event.Context,
+			event.Changes,
 		)
 	}
 
@@ -74,3 +78,116 @@ func (r *AuditLog) Insert(ctx context.Context, events []*auditlog.Model) error {
 	log.Info().Msgf("Successfully inserted %d audit events", len(events))
 	return nil
 }
+
+// eventColumns are the columns scanned by scanEvent, in order.
+const eventColumns = `id::text, spec_version, source, type, COALESCE(subject, ''), timestamp, actor, action, resource, COALESCE(metadata, '{}'), changes`
+
+// FindByID returns the stored event of id, upcast into the current spec_version.
+func (r *AuditLog) FindByID(ctx context.Context, id string) (*auditlog.Model, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, auditlog.ErrAuditLogNotFound
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	event, err := ReadEvent(r.db.QueryRow(timeoutCtx, `SELECT `+eventColumns+` FROM audit_logs WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, auditlog.ErrAuditLogNotFound
+	}
+	return event, err
+}
+
+// ReadEvent scans a row of eventColumns into an event of the current
+// spec_version, upcasting the rows stored with an older one, which the
+// backfill may not have rewritten yet.
+func ReadEvent(row pgx.Row) (*auditlog.Model, error) {
+	event, err := scanEvent(row)
+	if err != nil {
+		return nil, err
+	}
+	current, err := logsreporting.UpcastEvent((*logsreporting.AuditLog)(event))
+	if err != nil {
+		return nil, fmt.Errorf("audit log %s: %w", event.ID, err)
+	}
+	return (*auditlog.Model)(current), nil
+}
+
+// scanEvent scans a row of eventColumns into the event as stored.
+func scanEvent(row pgx.Row) (*auditlog.Model, error) {
+	event := &auditlog.Model{}
+	if err := row.Scan(
+		&event.ID,
+		&event.SpecVersion,
+		&event.Source,
+		&event.Type,
+		&event.Subject,
+		&event.Timestamp,
+		&event.Actor,
+		&event.Action,
+		&event.Resource,
+		&event.Context,
+		&event.Changes,
+	); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *AuditLog) Outdated(ctx context.Context, after string, limit int) ([]*auditlog.Model, error) {
+	if after == "" {
+		after = uuid.Nil.String()
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	rows, err := r.db.Query(timeoutCtx, `
+		SELECT `+eventColumns+`
+		FROM audit_logs
+		WHERE id > $1::uuid AND spec_version <> $2
+		ORDER BY id
+		LIMIT $3
+	`, after, logsreporting.SpecVersion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*auditlog.Model
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *AuditLog) Update(ctx context.Context, events []*auditlog.Model) error {
+	if len(events) == 0 {
+		return nil
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	query := `
+		UPDATE audit_logs
+		SET spec_version = $2, source = $3, type = $4, subject = $5, timestamp = $6, actor = $7, action = $8, resource = $9, metadata = $10, changes = $11
+		WHERE id = $1
+	`
+
+	batch := &pgx.Batch{}
+	for _, event := range events {
+		batch.Queue(query,
+			event.ID,
+			event.SpecVersion,
+			event.Source,
+			event.Type,
+			event.Subject,
+			event.Timestamp,
+			event.Actor,
+			event.Action,
+			event.Resource,
+			event.Context,
+			event.Changes,
+		)
+	}
+	return r.db.SendBatch(timeoutCtx, batch).Close()
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog"
+	"time"
+)
+
+type Rejection struct {
+	db *pgxpool.Pool
+}
+
+func NewRejectionRepository(db *pgxpool.Pool) *Rejection {
+	return &Rejection{db: db}
+}
+
+func (r *Rejection) Reject(ctx context.Context, rejection *auditlog.Rejection) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := r.db.Exec(timeoutCtx, `
+		INSERT INTO audit_rejections (event_id, subject, header, payload, reason, errors, received_at)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5, $6, $7)
+	`,
+		rejection.EventID,
+		rejection.Subject,
+		rejection.Header,
+		rejection.Payload,
+		rejection.Reason,
+		rejection.Errors,
+		rejection.ReceivedAt,
+	)
+	return err
+}
@@ -0,0 +1,93 @@
+package repository_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog/repository"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// storedRow is a row of audit_logs as pgx returns it: the text and timestamp
+// columns as is, and the jsonb ones decoded into their destination.
+type storedRow []any
+
+func (r storedRow) Scan(dest ...any) error {
+	if len(dest) != len(r) {
+		return errors.New("unexpected column count")
+	}
+	for i, value := range r {
+		switch d := dest[i].(type) {
+		case *string:
+			*d = value.(string)
+		case *time.Time:
+			*d = value.(time.Time)
+		default:
+			if err := json.Unmarshal([]byte(value.(string)), d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type errRow struct{ err error }
+
+func (r errRow) Scan(...any) error { return r.err }
+
+func TestReadEvent(t *testing.T) {
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := func(specVersion, actor, resource string) storedRow {
+		return storedRow{
+			"11111111-1111-1111-1111-111111111111", specVersion, "backend.api", logsreporting.EventTypeChange, "",
+			timestamp, actor, "create", resource, `{}`, `[]`,
+		}
+	}
+	tests := map[string]struct {
+		row            pgx.Row
+		wantActor      logsreporting.Actor
+		wantAttributes any
+		wantErr        error
+	}{
+		"stored 1.0 row": {
+			row: row("1.0", `{"id":"u1"}`,
+				`{"id":"42","type":"account","attributes":{"id":"42","type":"account","attributes":"{\"name\":\"Ada\"}"}}`),
+			wantActor:      logsreporting.Actor{Type: "user", ID: "u1"},
+			wantAttributes: map[string]any{"name": "Ada"},
+		},
+		"current row": {
+			row:            row(logsreporting.SpecVersion, `{"type":"api_key","id":"k1"}`, `{"id":"42","type":"account","attributes":{"name":"Ada"}}`),
+			wantActor:      logsreporting.Actor{Type: "api_key", ID: "k1"},
+			wantAttributes: map[string]any{"name": "Ada"},
+		},
+		"unknown version": {
+			row:     row("9.0", `{"type":"user","id":"u1"}`, `{"id":"42","type":"account"}`),
+			wantErr: logsreporting.ErrInvalidEvent,
+		},
+		"no row": {
+			row:     errRow{err: pgx.ErrNoRows},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			event, err := repository.ReadEvent(tt.row)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, logsreporting.SpecVersion, event.SpecVersion)
+			assert.Equal(t, "11111111-1111-1111-1111-111111111111", event.ID)
+			assert.Equal(t, timestamp, event.Timestamp)
+			assert.Equal(t, tt.wantActor, event.Actor)
+			assert.Equal(t, "account", event.Resource.Type)
+			assert.Equal(t, tt.wantAttributes, event.Resource.Attributes)
+		})
+	}
+}
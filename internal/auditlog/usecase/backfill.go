@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"context"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
+	"github.com/rs/zerolog/log"
+)
+
+// Backfill upcasts the stored events of an older spec_version into the current
+// one, batch by batch, so that the table holds a single shape. It can be
+// interrupted and run again.
+type Backfill struct {
+	repository auditlog.BackfillRepository
+	redaction  *redact.Policy
+	batchSize  int
+}
+
+func NewBackfill(repository auditlog.BackfillRepository, redaction *redact.Policy, batchSize int) *Backfill {
+	return &Backfill{repository: repository, redaction: redaction, batchSize: batchSize}
+}
+
+// Run rewrites every outdated event and returns how many were rewritten. The
+// attributes of a legacy resource, unreadable by the JSON operators until now,
+// are redacted again on the way as they may predate the redaction policy.
+func (b *Backfill) Run(ctx context.Context) (int, error) {
+	var after string
+	var rewritten int
+	for {
+		events, err := b.repository.Outdated(ctx, after, b.batchSize)
+		if err != nil {
+			return rewritten, err
+		}
+		if len(events) == 0 {
+			return rewritten, nil
+		}
+		after = events[len(events)-1].ID
+
+		upcast := make([]*auditlog.Model, 0, len(events))
+		for _, event := range events {
+			legacy := event.Resource.Legacy()
+			current, err := logsreporting.UpcastEvent((*logsreporting.AuditLog)(event))
+			if err != nil {
+				// left as it is, an unknown spec_version is of a newer release
+				log.Error().Err(err).Str("event_id", event.ID).Msg("failed to upcast audit log")
+				continue
+			}
+			if legacy {
+				b.redaction.Event(current)
+			}
+			upcast = append(upcast, (*auditlog.Model)(current))
+		}
+		if err := b.repository.Update(ctx, upcast); err != nil {
+			return rewritten, err
+		}
+		rewritten += len(upcast)
+		log.Info().Int("rewritten", rewritten).Str("after", after).Msg("audit log events backfilled")
+	}
+}
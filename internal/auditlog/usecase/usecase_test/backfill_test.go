@@ -0,0 +1,97 @@
+package usecase_test
+
+import (
+	"context"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog"
+	"github.com/ramk42/omi-backend-assignment/internal/auditlog/usecase"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeBackfillRepository stores the events by id.
+type fakeBackfillRepository struct {
+	events  map[string]auditlog.Model
+	updates int
+}
+
+func (f *fakeBackfillRepository) Outdated(_ context.Context, after string, limit int) ([]*auditlog.Model, error) {
+	ids := make([]string, 0, len(f.events))
+	for id, event := range f.events {
+		if id > after && event.SpecVersion != logsreporting.SpecVersion {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var events []*auditlog.Model
+	for _, id := range ids {
+		if len(events) == limit {
+			break
+		}
+		event := f.events[id]
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+func (f *fakeBackfillRepository) Update(_ context.Context, events []*auditlog.Model) error {
+	for _, event := range events {
+		f.events[event.ID] = *event
+		f.updates++
+	}
+	return nil
+}
+
+func storedEvent(id, specVersion string, resource logsreporting.Resource) auditlog.Model {
+	return auditlog.Model{
+		SpecVersion: specVersion,
+		ID:          id,
+		Source:      "backend.api",
+		Type:        logsreporting.EventTypeChange,
+		Timestamp:   time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+		Actor:       logsreporting.Actor{ID: "alice", Type: "user"},
+		Action:      "account.update",
+		Resource:    resource,
+	}
+}
+
+func legacyResource(id, body string) logsreporting.Resource {
+	return logsreporting.Resource{
+		ID:         id,
+		Type:       "account",
+		Attributes: map[string]any{"id": id, "type": "account", "attributes": body},
+	}
+}
+
+func TestBackfill_Run(t *testing.T) {
+	repo := &fakeBackfillRepository{events: map[string]auditlog.Model{
+		"1": storedEvent("1", "1.0", legacyResource("1", `{"name":"Ada"}`)),
+		"2": storedEvent("2", "1.0", logsreporting.Resource{ID: "2", Type: "account", Attributes: map[string]any{"name": "Grace"}}),
+		"3": storedEvent("3", "1.0", legacyResource("3", "")),
+		"4": storedEvent("4", "1.0", legacyResource("4", `{"name":"Linus"}`)),
+		// structured attributes that look legacy are left as they are
+		"5": storedEvent("5", "1.0", logsreporting.Resource{ID: "5", Type: "account", Attributes: map[string]any{"id": "9", "type": "account", "attributes": "{}"}}),
+		"6": storedEvent("6", logsreporting.SpecVersion, logsreporting.Resource{ID: "6", Type: "account"}),
+		// written by a newer release
+		"7": storedEvent("7", "9.0", logsreporting.Resource{ID: "7", Type: "account"}),
+	}}
+
+	rewritten, err := usecase.NewBackfill(repo, nil, 2).Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, rewritten)
+	assert.Equal(t, 5, repo.updates)
+	for _, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		assert.Equal(t, logsreporting.SpecVersion, repo.events[id].SpecVersion, id)
+	}
+	assert.Equal(t, "9.0", repo.events["7"].SpecVersion)
+	assert.Equal(t, logsreporting.Resource{ID: "1", Type: "account", Attributes: map[string]any{"name": "Ada"}}, repo.events["1"].Resource)
+	assert.Equal(t, logsreporting.Resource{ID: "2", Type: "account", Attributes: map[string]any{"name": "Grace"}}, repo.events["2"].Resource)
+	assert.Equal(t, logsreporting.Resource{ID: "3", Type: "account"}, repo.events["3"].Resource)
+	assert.Equal(t, logsreporting.Resource{ID: "4", Type: "account", Attributes: map[string]any{"name": "Linus"}}, repo.events["4"].Resource)
+	assert.Equal(t, "{}", repo.events["5"].Resource.Attributes.(map[string]any)["attributes"])
+	assert.Equal(t, logsreporting.Actor{ID: "alice", Type: "user"}, repo.events["1"].Actor)
+}
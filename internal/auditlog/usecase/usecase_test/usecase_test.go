@@ -8,6 +8,7 @@ import (
 	"github.com/ramk42/omi-backend-assignment/internal/auditlog/repository"
 	"github.com/ramk42/omi-backend-assignment/internal/auditlog/usecase"
 	"github.com/ramk42/omi-backend-assignment/pkg/env"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -34,23 +35,26 @@ func generateTestEvent() *auditlog.Model {
 		Type:        "audit.event",
 		Subject:     "event:account:4eaa2b93-c0e2-4556-83a3-ecfbc7d60fa3",
 		Timestamp:   time.Now().UTC(),
-		Actor: map[string]string{
-			"id": uuid.NewString(),
+		Actor: logsreporting.Actor{
+			ID:   uuid.NewString(),
+			Type: "user",
 		},
-		Action: "PATCH",
-		Resource: map[string]any{
-			"id":   "4eaa2b93-c0e2-4556-83a3-ecfbc7d60fa3",
-			"type": "account",
-			"attributes": map[string]string{
-				"id":         "4eaa2b93-c0e2-4556-83a3-ecfbc7d60fa3",
-				"type":       "account",
-				"attributes": `{"name": "John Doe", "email": "john.doe@example.com"}`,
+		Action: "account.update",
+		Resource: logsreporting.Resource{
+			ID:   "4eaa2b93-c0e2-4556-83a3-ecfbc7d60fa3",
+			Type: "account",
+			Attributes: map[string]any{
+				"name":  "John Doe",
+				"email": "john.doe@example.com",
 			},
 		},
-		Metadata: map[string]string{
-			"request_id":      uuid.NewString(),
-			"response_status": "204",
-			"protocol":        "HTTP/1.1",
+		Context: logsreporting.Context{
+			RequestID:      uuid.NewString(),
+			ResponseStatus: 204,
+			Protocol:       "HTTP/1.1",
+		},
+		Changes: []logsreporting.Change{
+			{Field: "email", Old: "john@example.com", New: "john.doe@example.com"},
 		},
 	}
 }
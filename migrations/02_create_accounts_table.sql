@@ -0,0 +1,13 @@
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- account targeted by `make stress-test`
+INSERT INTO accounts (id, name, email)
+VALUES ('4eaa2b93-c0e2-4556-83a3-ecfbc7d60fa3', 'John Doe', 'john.doe@example.com')
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,22 @@
+
+-- emails are unique regardless of case: refuse to build the index over accounts
+-- that already share one, which must be resolved by hand (see documentation.md)
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(ids, '; ')
+    INTO duplicates
+    FROM (
+        SELECT string_agg(id::text, ', ' ORDER BY created_at) AS ids
+        FROM accounts
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) AS shared;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'accounts share an email in different cases: %', duplicates
+            USING HINT = 'keep a single account per email, then apply this migration again';
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_email ON accounts (lower(email));
@@ -0,0 +1,10 @@
+
+CREATE TABLE IF NOT EXISTS audit_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_outbox_pending ON audit_outbox (id) WHERE sent_at IS NULL;
@@ -0,0 +1,14 @@
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    service TEXT NOT NULL,
+    tenant TEXT NOT NULL DEFAULT '',
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    secret_hash TEXT NOT NULL,
+    previous_secret_hash TEXT,
+    previous_secret_expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rotated_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    CHECK (char_length(service) > 0)
+);
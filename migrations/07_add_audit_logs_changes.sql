@@ -0,0 +1,2 @@
+
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS changes JSONB;
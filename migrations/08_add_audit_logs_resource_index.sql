@@ -0,0 +1,2 @@
+-- lets the JSON operators of Postgres (@>) query the resource of the events, e.g. resource @> '{"attributes": {"name": "Ada"}}'
+CREATE INDEX IF NOT EXISTS idx_resource ON audit_logs USING GIN (resource jsonb_path_ops);
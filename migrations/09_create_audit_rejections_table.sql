@@ -0,0 +1,13 @@
+-- messages refused by the audit log consumer, kept as received with the reason and validation errors
+CREATE TABLE IF NOT EXISTS audit_rejections (
+    id BIGSERIAL PRIMARY KEY,
+    event_id TEXT,
+    subject TEXT NOT NULL,
+    header JSONB,
+    payload BYTEA NOT NULL,
+    reason TEXT NOT NULL,
+    errors JSONB NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_rejections_received_at ON audit_rejections (received_at);
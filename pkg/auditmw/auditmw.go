@@ -0,0 +1,282 @@
+// Package auditmw records an audit event per request served by a chi router.
+package auditmw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/rs/zerolog/log"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Audit outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+const (
+	// failClosedPublishTimeout bounds how long a fail-closed request waits for its event to be published.
+	failClosedPublishTimeout = 5 * time.Second
+	// failOpenPublishTimeout bounds how long another request waits for room in
+	// the producer, e.g. a queue with the block overflow policy.
+	failOpenPublishTimeout = time.Second
+)
+
+// New returns a middleware recording an audit event per request, as decided by
+// the audit rules, and publishing it with producer. Reads are recorded as
+// lighter access events, which repeated reads may be collapsed into by the
+// deduplicator. Personal data is redacted from the event before it leaves the
+// service, whether it is published or written to the outbox.
+//
+// The event is composed through a logsreporting.Draft placed in the request
+// context: handlers may set its resource id and action, annotate it, or commit
+// it to an outbox along with their change.
+//
+// It relies on the matched route pattern, so it must be registered on the group
+// of the routes (after routing) rather than on the router.
+//
+// On fail-closed routes the response is held back until the event is recorded.
+// A successful mutation must commit its event with the change through the
+// outbox (outbox.WithinTx), or flag the draft as unchanged, which the service
+// has to verify when its routes are wired. A change committed without its
+// event can no longer be rejected: the misconfiguration is logged, the event
+// published as well as possible and the response left as it is. Other
+// requests (reads, failed or unchanged mutations) have their event published
+// synchronously, the response being replaced with a 503 if that fails.
+func New(producer logsreporting.Producer, opts ...Option) func(http.Handler) http.Handler {
+	cfg := defaultConfig(producer)
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := middleware.GetReqID(r.Context())
+			body, truncated := captureBody(r, cfg.bodyLimit)
+			eventID := uuid.NewString()
+			actor := cfg.actor(r.Context())
+			// the source of the request, RemoteAddr being the client address once RealIP ran
+			if actor.IP == "" {
+				actor.IP = logsreporting.ClientIP(r.RemoteAddr)
+			}
+			if actor.UserAgent == "" {
+				actor.UserAgent = r.UserAgent()
+			}
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			// drawn once so that the request is either sampled in or out, whenever the event is composed
+			roll := rand.Float64()
+			access := r.Method == http.MethodGet || r.Method == http.MethodHead
+			var dedupWindow time.Duration
+			draft := logsreporting.NewDraft(cfg.resourceID(r), func(resourceID, action string, changes []logsreporting.Change, reqCtx logsreporting.Context) *logsreporting.AuditLog {
+				if reqCtx.Outcome == "" {
+					reqCtx.Outcome = OutcomeSuccess
+					if reqCtx.ResponseStatus >= http.StatusBadRequest {
+						reqCtx.Outcome = OutcomeFailure
+					}
+				}
+				decision := cfg.rules.Decide(auditrules.Request{
+					Route:         route,
+					Method:        r.Method,
+					Outcome:       reqCtx.Outcome,
+					ChangedFields: changedFields(changes),
+				})
+				if !decision.Sampled(roll) {
+					return nil
+				}
+
+				resourceType := cfg.resourceType
+				if decision.ResourceType != "" {
+					resourceType = decision.ResourceType
+				}
+				switch {
+				case decision.Action != "":
+					action = decision.Action
+				case action == "":
+					action = cfg.action(resourceType, r.Method, resourceID)
+				}
+
+				reqCtx.RequestID = requestID
+				reqCtx.IP = logsreporting.ClientIP(r.RemoteAddr)
+				reqCtx.UserAgent = r.UserAgent()
+				reqCtx.Method = r.Method
+				eventType := logsreporting.EventTypeChange
+				resource := logsreporting.Resource{ID: resourceID, Type: resourceType}
+				if access {
+					// who viewed what: no payload, changes nor protocol details
+					eventType = logsreporting.EventTypeAccess
+					changes = nil
+					dedupWindow = decision.DedupWindow
+				} else {
+					if decision.IncludeBodies {
+						resource.Attributes = body
+						if truncated {
+							reqCtx.Set("body_truncated", "true")
+						}
+					}
+					reqCtx.Protocol = r.Proto
+					if decision.SampleRate < 1 {
+						reqCtx.Set("sample_rate", strconv.FormatFloat(decision.SampleRate, 'f', -1, 64))
+					}
+				}
+
+				auditLog, err := logsreporting.NewEvent(eventType, cfg.source).
+					ID(eventID).
+					Actor(actor).
+					Action(action).
+					Resource(resource).
+					Context(reqCtx).
+					Changes(changes).
+					Build()
+				if err != nil {
+					log.Ctx(r.Context()).Error().Err(err).Msg("failure to build audit event")
+					return nil
+				}
+				cfg.redaction.Event(auditLog)
+				return auditLog
+			})
+			r = r.WithContext(logsreporting.ContextWithDraft(r.Context(), draft))
+
+			failClosed := cfg.rules.FailClosed(route, r.Method)
+			var held *heldResponse
+			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			if failClosed {
+				held = &heldResponse{header: w.Header().Clone(), statusCode: http.StatusOK}
+				recorder.ResponseWriter = held
+			}
+			next.ServeHTTP(recorder, r)
+
+			// the event was committed to the outbox along with the change, the relay publishes it
+			if draft.Recorded() {
+				held.release(w)
+				return
+			}
+
+			auditLog := draft.Event(map[string]string{
+				"response_status": strconv.Itoa(recorder.statusCode),
+			})
+			if auditLog == nil {
+				held.release(w)
+				return
+			}
+
+			if failClosed && !access && recorder.statusCode < http.StatusBadRequest && !draft.Unchanged() {
+				log.Ctx(r.Context()).Error().Str("event_id", auditLog.ID).Str("route", route).Str("method", r.Method).
+					Msg("fail-closed route committed a change without recording its audit event through the outbox")
+				if err := cfg.publishSync(r.Context(), auditLog); err != nil {
+					// handed over to the producer, which may still spool it
+					ctx, cancel := context.WithTimeout(cfg.baseCtx, failOpenPublishTimeout)
+					defer cancel()
+					if err := cfg.producer.Publish(ctx, auditLog); err != nil {
+						log.Error().Err(err).Str("event_id", auditLog.ID).Msg("failure to publish audit event")
+					}
+				}
+				held.release(w)
+				return
+			}
+
+			if failClosed {
+				if err := cfg.publishSync(r.Context(), auditLog); err != nil {
+					log.Ctx(r.Context()).Error().Err(err).Str("event_id", auditLog.ID).Msg("rejecting request that cannot be audited")
+					writeProblem(w, http.StatusServiceUnavailable, logsreporting.ErrAuditUnavailable.Error())
+					return
+				}
+				held.release(w)
+				return
+			}
+
+			// the producer is usually a bounded queue, publishing only waits when it is full and configured to block
+			ctx, cancel := context.WithTimeout(cfg.baseCtx, failOpenPublishTimeout)
+			defer cancel()
+			if dedupWindow > 0 && cfg.dedup != nil {
+				cfg.dedup.Add(ctx, auditLog, dedupWindow)
+				return
+			}
+			if err := cfg.producer.Publish(ctx, auditLog); err != nil {
+				log.Error().Err(err).Msg("failure to publish audit event")
+			}
+		})
+	}
+}
+
+func (c *config) publishSync(ctx context.Context, event *logsreporting.AuditLog) error {
+	if c.syncProducer == nil {
+		return logsreporting.ErrAuditUnavailable
+	}
+	ctx, cancel := context.WithTimeout(ctx, failClosedPublishTimeout)
+	defer cancel()
+	return c.syncProducer.PublishSync(ctx, event)
+}
+
+// captureBody returns the JSON document of the request body, restoring it for
+// the next handlers. Bodies larger than limit or that are not valid JSON are not captured.
+func captureBody(r *http.Request, limit int64) (body any, truncated bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+	head, _ := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if int64(len(head)) > limit {
+		r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), r.Body), Closer: r.Body}
+		return nil, true
+	}
+	r.Body = io.NopCloser(bytes.NewReader(head))
+	if err := json.Unmarshal(head, &body); err != nil {
+		return nil, false
+	}
+	return body, false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Action maps the HTTP method to the semantic operation performed on the
+// resource, e.g. "account.update" for a PATCH.
+func Action(resourceType, method, resourceID string) string {
+	var verb string
+	switch method {
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodGet, http.MethodHead:
+		verb = "read"
+		if resourceID == "" {
+			verb = "list"
+		}
+	case http.MethodPut, http.MethodPatch:
+		verb = "update"
+	case http.MethodDelete:
+		verb = "delete"
+	default:
+		return method
+	}
+	return resourceType + "." + verb
+}
+
+func changedFields(changes []logsreporting.Change) []string {
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	})
+}
@@ -0,0 +1,308 @@
+package auditmw_test
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditmw"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeProducer struct {
+	mu     sync.Mutex
+	events []*logsreporting.AuditLog
+	err    error
+}
+
+func (f *fakeProducer) Publish(_ context.Context, event *logsreporting.AuditLog) error {
+	return f.PublishSync(context.Background(), event)
+}
+
+func (f *fakeProducer) PublishSync(_ context.Context, event *logsreporting.AuditLog) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+type producer interface {
+	logsreporting.Producer
+	logsreporting.SyncProducer
+}
+
+func router(t *testing.T, producer producer, opts ...auditmw.Option) http.Handler {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [{"route": "/accounts/{resourceID}", "methods": ["DELETE"], "fail_closed": true}]}`), 0o600))
+	rules, err := auditrules.LoadFile(path)
+	require.NoError(t, err)
+
+	opts = append([]auditmw.Option{
+		auditmw.WithSyncProducer(producer),
+		auditmw.WithDeduplicator(logsreporting.NewDeduplicator(producer, 0)),
+		auditmw.WithRules(rules),
+		auditmw.WithResourceType("account"),
+	}, opts...)
+
+	r := chi.NewRouter()
+	r.Route("/accounts", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(auditmw.New(producer, opts...))
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				w.Header().Set("ETag", `"2"`)
+				w.WriteHeader(http.StatusNoContent)
+			}
+			r.Get("/{resourceID}", handler)
+			// the query tells how the deletion went, as a handler recording through the outbox would
+			r.Delete("/{resourceID}", func(w http.ResponseWriter, r *http.Request) {
+				draft := logsreporting.DraftFromContext(r.Context())
+				switch r.URL.Query().Get("result") {
+				case "recorded":
+					draft.MarkRecorded()
+				case "unchanged":
+					draft.MarkUnchanged()
+				case "missing":
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				handler(w, r)
+			})
+			r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				_, _ = w.Write(body)
+			})
+		})
+	})
+	return r
+}
+
+func TestMiddleware_FailClosedRecordedMutation(t *testing.T) {
+	producer := &fakeProducer{err: logsreporting.ErrAuditUnavailable}
+	rec := httptest.NewRecorder()
+	router(t, producer).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/accounts/42?result=recorded", nil))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+}
+
+func TestMiddleware_FailClosedPublishesBeforeResponding(t *testing.T) {
+	tests := map[string]struct {
+		result string
+		status int
+	}{
+		"unchanged mutation": {result: "unchanged", status: http.StatusNoContent},
+		"failed mutation":    {result: "missing", status: http.StatusNotFound},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			producer := &fakeProducer{}
+			rec := httptest.NewRecorder()
+			router(t, producer).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/accounts/42?result="+tt.result, nil))
+
+			assert.Equal(t, tt.status, rec.Code)
+			require.Len(t, producer.events, 1)
+			assert.Equal(t, "account.delete", producer.events[0].Action)
+			assert.Equal(t, "42", producer.events[0].Resource.ID)
+		})
+	}
+}
+
+func TestMiddleware_FailClosedRejectsUnauditedRequest(t *testing.T) {
+	producer := &fakeProducer{err: logsreporting.ErrAuditUnavailable}
+	rec := httptest.NewRecorder()
+	router(t, producer).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/accounts/42?result=unchanged", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
+
+func TestMiddleware_FailClosedWithoutSyncProducer(t *testing.T) {
+	producer := &fakeProducer{}
+	rec := httptest.NewRecorder()
+	router(t, producer, auditmw.WithSyncProducer(nil)).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/accounts/42?result=unchanged", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Empty(t, producer.events)
+}
+
+func TestMiddleware_FailClosedChangeWithoutOutbox(t *testing.T) {
+	tests := map[string]struct {
+		err       error
+		published int
+	}{
+		"published synchronously": {published: 1},
+		"broker unavailable":      {err: logsreporting.ErrAuditUnavailable},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			producer := &fakeProducer{err: tt.err}
+			rec := httptest.NewRecorder()
+			router(t, producer).ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/accounts/42", nil))
+
+			// the change happened and cannot be rejected anymore, the response stays truthful
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+			assert.Len(t, producer.events, tt.published)
+		})
+	}
+}
+
+func TestMiddleware_FailOpenIgnoresPublishFailure(t *testing.T) {
+	producer := &fakeProducer{err: errors.New("nats down")}
+	rec := httptest.NewRecorder()
+	router(t, producer).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/42", nil))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+// fullProducer is a queue that stays full, with the block overflow policy.
+type fullProducer struct {
+	fakeProducer
+	deadline bool
+}
+
+func (f *fullProducer) Publish(ctx context.Context, _ *logsreporting.AuditLog) error {
+	_, f.deadline = ctx.Deadline()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestMiddleware_FailOpenDoesNotWaitForeverForTheProducer(t *testing.T) {
+	producer := &fullProducer{}
+	rec := httptest.NewRecorder()
+	handler := router(t, producer)
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(`{}`)))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request is held by the producer")
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, producer.deadline)
+}
+
+func TestMiddleware_ReadsAreAccessEvents(t *testing.T) {
+	producer := &fakeProducer{}
+	rec := httptest.NewRecorder()
+	router(t, producer).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/42", nil))
+
+	require.Len(t, producer.events, 1)
+	event := producer.events[0]
+	assert.Equal(t, logsreporting.EventTypeAccess, event.Type)
+	assert.Equal(t, "account.read", event.Action)
+	assert.Equal(t, "backend.api", event.Source)
+	assert.Equal(t, logsreporting.Resource{ID: "42", Type: "account"}, event.Resource)
+	assert.Equal(t, logsreporting.Actor{Type: logsreporting.ActorAnonymous, IP: "192.0.2.1"}, event.Actor)
+	assert.Empty(t, event.Changes)
+}
+
+func TestMiddleware_RecordsRequestSource(t *testing.T) {
+	tests := map[string]struct {
+		method, path string
+		remoteAddr   string
+		forwardedFor string
+		eventType    string
+		wantIP       string
+	}{
+		"read":                   {method: http.MethodGet, path: "/accounts/42", forwardedFor: "203.0.113.7", eventType: logsreporting.EventTypeAccess, wantIP: "203.0.113.7"},
+		"mutation":               {method: http.MethodPost, path: "/accounts", forwardedFor: "203.0.113.7", eventType: logsreporting.EventTypeChange, wantIP: "203.0.113.7"},
+		"port stripped":          {method: http.MethodPost, path: "/accounts", remoteAddr: "203.0.113.7:52814", eventType: logsreporting.EventTypeChange, wantIP: "203.0.113.7"},
+		"ipv6 port stripped":     {method: http.MethodGet, path: "/accounts/42", remoteAddr: "[2001:db8::1]:52814", eventType: logsreporting.EventTypeAccess, wantIP: "2001:db8::1"},
+		"address without a port": {method: http.MethodGet, path: "/accounts/42", remoteAddr: "2001:db8::1", eventType: logsreporting.EventTypeAccess, wantIP: "2001:db8::1"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			producer := &fakeProducer{}
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			req.Header.Set("User-Agent", "curl/8.5.0")
+			middleware.RealIP(router(t, producer)).ServeHTTP(httptest.NewRecorder(), req)
+
+			require.Len(t, producer.events, 1)
+			event := producer.events[0]
+			assert.Equal(t, tt.eventType, event.Type)
+			assert.Equal(t, tt.wantIP, event.Context.IP)
+			assert.Equal(t, "curl/8.5.0", event.Context.UserAgent)
+			assert.Equal(t, tt.method, event.Context.Method)
+			assert.Equal(t, tt.wantIP, event.Actor.IP)
+			assert.Equal(t, "curl/8.5.0", event.Actor.UserAgent)
+		})
+	}
+}
+
+func TestMiddleware_Options(t *testing.T) {
+	producer := &fakeProducer{}
+	handler := router(t, producer,
+		auditmw.WithSource("billing.api"),
+		auditmw.WithResourceType("invoice"),
+		auditmw.WithResourceIDExtractor(func(r *http.Request) string { return r.Header.Get("X-Invoice-ID") }),
+		auditmw.WithActorResolver(func(context.Context) logsreporting.Actor { return logsreporting.Actor{ID: "bob", Type: "user"} }),
+		auditmw.WithActionResolver(func(resourceType, method, _ string) string { return resourceType + ":" + strings.ToLower(method) }),
+	)
+	req := httptest.NewRequest(http.MethodGet, "/accounts/42", nil)
+	req.Header.Set("X-Invoice-ID", "inv-7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, producer.events, 1)
+	event := producer.events[0]
+	assert.Equal(t, "billing.api", event.Source)
+	assert.Equal(t, "invoice:get", event.Action)
+	assert.Equal(t, "event:invoice:inv-7", event.Subject)
+	assert.Equal(t, "bob", event.Actor.ID)
+}
+
+func TestMiddleware_BodyLimit(t *testing.T) {
+	tests := map[string]struct {
+		body      string
+		captured  any
+		truncated bool
+	}{
+		"within limit":  {body: `{ "name": "Ada" }`, captured: map[string]any{"name": "Ada"}},
+		"above limit":   {body: `{"name": "` + strings.Repeat("a", 64) + `"}`, truncated: true},
+		"exactly limit": {body: `{"name":"Lovelace-Byron"}`, captured: map[string]any{"name": "Lovelace-Byron"}},
+		"not json":      {body: `name=Ada`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			producer := &fakeProducer{}
+			rec := httptest.NewRecorder()
+			router(t, producer, auditmw.WithBodyLimit(25)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/accounts/", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.body, rec.Body.String(), "the handler reads the whole body")
+			require.Len(t, producer.events, 1)
+			event := producer.events[0]
+			assert.Equal(t, tt.captured, event.Resource.Attributes)
+			if tt.truncated {
+				assert.Equal(t, "true", event.Context.Get("body_truncated"))
+			} else {
+				assert.NotContains(t, event.Context.Metadata(), "body_truncated")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package auditmw
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
+	"net/http"
+)
+
+const (
+	defaultSource    = "backend.api"
+	defaultBodyLimit = 64 << 10
+)
+
+// Option configures the middleware.
+type Option func(*config)
+
+type config struct {
+	baseCtx      context.Context
+	producer     logsreporting.Producer
+	syncProducer logsreporting.SyncProducer
+	dedup        *logsreporting.Deduplicator
+	rules        *auditrules.Rules
+	redaction    *redact.Policy
+	source       string
+	resourceType string
+	resourceID   func(r *http.Request) string
+	actor        func(ctx context.Context) logsreporting.Actor
+	action       func(resourceType, method, resourceID string) string
+	bodyLimit    int64
+}
+
+func defaultConfig(producer logsreporting.Producer) config {
+	return config{
+		baseCtx:    context.Background(),
+		producer:   producer,
+		source:     defaultSource,
+		resourceID: func(r *http.Request) string { return chi.URLParam(r, "resourceID") },
+		actor: func(context.Context) logsreporting.Actor {
+			return logsreporting.Actor{Type: logsreporting.ActorAnonymous}
+		},
+		action:    Action,
+		bodyLimit: defaultBodyLimit,
+	}
+}
+
+// WithBaseContext sets the context events are published with after the
+// response, which outlives the request. Defaults to context.Background().
+func WithBaseContext(ctx context.Context) Option {
+	return func(c *config) { c.baseCtx = ctx }
+}
+
+// WithSyncProducer sets the producer used on fail-closed routes. Without it,
+// requests of fail-closed routes that are not recorded through the outbox are rejected.
+func WithSyncProducer(producer logsreporting.SyncProducer) Option {
+	return func(c *config) { c.syncProducer = producer }
+}
+
+// WithDeduplicator collapses repeated access events, as configured by the dedup_window_sec rule setting.
+func WithDeduplicator(dedup *logsreporting.Deduplicator) Option {
+	return func(c *config) { c.dedup = dedup }
+}
+
+// WithRules sets the audit rules. Every request is audited without them.
+func WithRules(rules *auditrules.Rules) Option {
+	return func(c *config) { c.rules = rules }
+}
+
+// WithRedaction redacts personal data from the events.
+func WithRedaction(policy *redact.Policy) Option {
+	return func(c *config) { c.redaction = policy }
+}
+
+// WithSource sets the source of the events. Defaults to "backend.api".
+func WithSource(source string) Option {
+	return func(c *config) { c.source = source }
+}
+
+// WithResourceType sets the type of the resources served by the routes.
+func WithResourceType(resourceType string) Option {
+	return func(c *config) { c.resourceType = resourceType }
+}
+
+// WithResourceIDExtractor sets how the id of the resource is read from the
+// request. Defaults to the "resourceID" route parameter.
+func WithResourceIDExtractor(extract func(r *http.Request) string) Option {
+	return func(c *config) { c.resourceID = extract }
+}
+
+// WithActorResolver sets how the actor is described from the request context,
+// typically from the authenticated principal. Defaults to an anonymous actor.
+func WithActorResolver(resolve func(ctx context.Context) logsreporting.Actor) Option {
+	return func(c *config) { c.actor = resolve }
+}
+
+// WithActionResolver sets how the action is derived from the request. Defaults to Action.
+func WithActionResolver(resolve func(resourceType, method, resourceID string) string) Option {
+	return func(c *config) { c.action = resolve }
+}
+
+// WithBodyLimit sets the number of bytes of the request body captured in the
+// event. Larger bodies are left out and flagged with the body_truncated
+// metadata. Defaults to 64 KiB.
+func WithBodyLimit(limit int64) Option {
+	return func(c *config) { c.bodyLimit = limit }
+}
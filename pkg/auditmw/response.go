@@ -0,0 +1,41 @@
+package auditmw
+
+import (
+	"bytes"
+	"net/http"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	sr.statusCode = statusCode
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// heldResponse buffers a response until it is known whether it can be sent.
+type heldResponse struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (h *heldResponse) Header() http.Header { return h.header }
+
+func (h *heldResponse) WriteHeader(statusCode int) { h.statusCode = statusCode }
+
+func (h *heldResponse) Write(b []byte) (int, error) { return h.body.Write(b) }
+
+// release sends the buffered response to w. It does nothing on a nil heldResponse.
+func (h *heldResponse) release(w http.ResponseWriter) {
+	if h == nil {
+		return
+	}
+	for key, values := range h.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(h.statusCode)
+	_, _ = w.Write(h.body.Bytes())
+}
@@ -0,0 +1,4 @@
+// Package auditpb holds the protobuf wire format of the audit events.
+package auditpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative audit_log.proto
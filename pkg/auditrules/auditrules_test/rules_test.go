@@ -0,0 +1,97 @@
+package auditrules_test
+
+import (
+	"github.com/ramk42/omi-backend-assignment/pkg/auditrules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadRules(t *testing.T, content string) (*auditrules.Rules, error) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return auditrules.LoadFile(path)
+}
+
+func TestRules_Decide(t *testing.T) {
+	rules, err := loadRules(t, `{
+	  "defaults": {"include_bodies": false},
+	  "rules": [
+	    {"route": "/accounts/{resourceID}", "methods": ["patch"], "changed_fields": ["email"], "action": "account.email.changed", "include_bodies": true},
+	    {"route": "/accounts", "methods": ["GET"], "outcomes": ["success"], "sample_rate": 0.1},
+	    {"route": "/admin/*", "audit": false}
+	  ]
+	}`)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		req      auditrules.Request
+		expected auditrules.Decision
+	}{
+		"email change": {
+			req:      auditrules.Request{Route: "/accounts/{resourceID}", Method: "PATCH", ChangedFields: []string{"name", "email"}},
+			expected: auditrules.Decision{Audit: true, IncludeBodies: true, SampleRate: 1, Action: "account.email.changed"},
+		},
+		"name change falls back to defaults": {
+			req:      auditrules.Request{Route: "/accounts/{resourceID}", Method: "PATCH", ChangedFields: []string{"name"}},
+			expected: auditrules.Decision{Audit: true, SampleRate: 1},
+		},
+		"successful list is sampled": {
+			req:      auditrules.Request{Route: "/accounts", Method: "GET", Outcome: "success"},
+			expected: auditrules.Decision{Audit: true, SampleRate: 0.1},
+		},
+		"failed list is not": {
+			req:      auditrules.Request{Route: "/accounts", Method: "GET", Outcome: "failure"},
+			expected: auditrules.Decision{Audit: true, SampleRate: 1},
+		},
+		"prefix": {
+			req:      auditrules.Request{Route: "/admin/api-keys/{resourceID}", Method: "DELETE"},
+			expected: auditrules.Decision{SampleRate: 1},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, rules.Decide(tt.req))
+		})
+	}
+}
+
+func TestDecision_Sampled(t *testing.T) {
+	decision := auditrules.Decision{Audit: true, SampleRate: 0.25}
+	assert.True(t, decision.Sampled(0.1))
+	assert.False(t, decision.Sampled(0.25))
+
+	decision.Audit = false
+	assert.False(t, decision.Sampled(0))
+}
+
+func TestRules_NilAuditsEverything(t *testing.T) {
+	var rules *auditrules.Rules
+	assert.Equal(t, auditrules.Decision{Audit: true, IncludeBodies: true, SampleRate: 1}, rules.Decide(auditrules.Request{}))
+}
+
+func TestLoadFile_Rejects(t *testing.T) {
+	_, err := loadRules(t, `{"rules": [{"methods": ["GET"]}]}`)
+	assert.Error(t, err, "rule without route")
+
+	_, err = loadRules(t, `{"defaults": {"sample_rate": 2}}`)
+	assert.Error(t, err, "sample rate out of range")
+}
+
+func TestRules_FailClosed(t *testing.T) {
+	rules, err := loadRules(t, `{
+	  "rules": [
+	    {"route": "/accounts/{resourceID}", "methods": ["GET"], "sample_rate": 0.5},
+	    {"route": "/accounts/{resourceID}", "outcomes": ["success"], "fail_closed": true},
+	    {"route": "/accounts", "methods": ["POST"], "fail_closed": true}
+	  ]
+	}`)
+	require.NoError(t, err)
+
+	assert.True(t, rules.FailClosed("/accounts/{resourceID}", "GET"), "outcome conditions are not known yet")
+	assert.True(t, rules.FailClosed("/accounts/{resourceID}", "DELETE"))
+	assert.True(t, rules.FailClosed("/accounts", "POST"))
+	assert.False(t, rules.FailClosed("/accounts", "GET"))
+}
@@ -0,0 +1,178 @@
+package auditrules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Settings are the auditing choices made for a request. Unset settings of a
+// rule are inherited from the defaults of the file.
+type Settings struct {
+	Audit         *bool    `json:"audit"`
+	IncludeBodies *bool    `json:"include_bodies"`
+	SampleRate    *float64 `json:"sample_rate"`
+	// FailClosed rejects the requests that cannot be audited.
+	FailClosed *bool `json:"fail_closed"`
+	// DedupWindowSec collapses the access events of an actor on a resource
+	// within that many seconds into one.
+	DedupWindowSec *int `json:"dedup_window_sec"`
+}
+
+// Rule applies to the requests matching all of its non-empty conditions.
+type Rule struct {
+	// Route is a chi route pattern such as "/accounts/{resourceID}"; a trailing
+	// "*" matches every route under the prefix.
+	Route   string   `json:"route"`
+	Methods []string `json:"methods"`
+	// Outcomes restricts the rule to "success", "failure" or "denied" requests.
+	Outcomes []string `json:"outcomes"`
+	// ChangedFields restricts the rule to mutations of at least one of these fields.
+	ChangedFields []string `json:"changed_fields"`
+
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	Settings
+}
+
+// Rules decides which requests are audited and how. The first matching rule wins.
+type Rules struct {
+	Defaults Settings `json:"defaults"`
+	Rules    []Rule   `json:"rules"`
+}
+
+// Request describes an audited request once it has been served.
+type Request struct {
+	Route         string
+	Method        string
+	Outcome       string
+	ChangedFields []string
+}
+
+// Decision is the outcome of the rules for a request. Empty Action and
+// ResourceType leave the ones derived by the middleware.
+type Decision struct {
+	Audit         bool
+	IncludeBodies bool
+	SampleRate    float64
+	DedupWindow   time.Duration
+	Action        string
+	ResourceType  string
+}
+
+// FailClosed reports whether the requests of a route and method must be
+// rejected when they cannot be audited. It has to be known before the request
+// is served, so only the route and methods of the rules are considered.
+func (r *Rules) FailClosed(route, method string) bool {
+	if r == nil {
+		return false
+	}
+	for _, rule := range r.Rules {
+		if rule.FailClosed != nil && rule.matches(Request{Route: route, Method: method}, false) {
+			return *rule.FailClosed
+		}
+	}
+	return r.Defaults.FailClosed != nil && *r.Defaults.FailClosed
+}
+
+// Sampled reports whether the request is audited given roll, a number drawn
+// uniformly in [0, 1) once per request.
+func (d Decision) Sampled(roll float64) bool {
+	return d.Audit && roll < d.SampleRate
+}
+
+// LoadFile reads the rules from a JSON file.
+func LoadFile(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid audit rules %s: %w", path, err)
+	}
+	if err := rules.validate(); err != nil {
+		return nil, fmt.Errorf("invalid audit rules %s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+func (r *Rules) validate() error {
+	settings := []Settings{r.Defaults}
+	for i, rule := range r.Rules {
+		if rule.Route == "" {
+			return fmt.Errorf("rule %d has no route", i)
+		}
+		settings = append(settings, rule.Settings)
+	}
+	for _, s := range settings {
+		if s.SampleRate != nil && (*s.SampleRate < 0 || *s.SampleRate > 1) {
+			return fmt.Errorf("sample_rate %v is not within [0, 1]", *s.SampleRate)
+		}
+		if s.DedupWindowSec != nil && *s.DedupWindowSec < 0 {
+			return fmt.Errorf("dedup_window_sec %d is negative", *s.DedupWindowSec)
+		}
+	}
+	return nil
+}
+
+// Decide returns the decision for req. A nil Rules audits everything, bodies included.
+func (r *Rules) Decide(req Request) Decision {
+	decision := Decision{Audit: true, IncludeBodies: true, SampleRate: 1}
+	if r == nil {
+		return decision
+	}
+	decision.apply(r.Defaults)
+	for _, rule := range r.Rules {
+		if rule.matches(req, true) {
+			decision.apply(rule.Settings)
+			decision.Action = rule.Action
+			decision.ResourceType = rule.ResourceType
+			break
+		}
+	}
+	return decision
+}
+
+func (d *Decision) apply(s Settings) {
+	if s.Audit != nil {
+		d.Audit = *s.Audit
+	}
+	if s.IncludeBodies != nil {
+		d.IncludeBodies = *s.IncludeBodies
+	}
+	if s.SampleRate != nil {
+		d.SampleRate = *s.SampleRate
+	}
+	if s.DedupWindowSec != nil {
+		d.DedupWindow = time.Duration(*s.DedupWindowSec) * time.Second
+	}
+}
+
+// matches tells whether the rule applies to req, disregarding its outcome and
+// changed fields conditions when served is false.
+func (r Rule) matches(req Request, served bool) bool {
+	if prefix, ok := strings.CutSuffix(r.Route, "*"); ok {
+		if !strings.HasPrefix(req.Route, prefix) {
+			return false
+		}
+	} else if r.Route != req.Route {
+		return false
+	}
+	if len(r.Methods) > 0 && !slices.ContainsFunc(r.Methods, func(m string) bool { return strings.EqualFold(m, req.Method) }) {
+		return false
+	}
+	if !served {
+		return true
+	}
+	if len(r.Outcomes) > 0 && !slices.Contains(r.Outcomes, req.Outcome) {
+		return false
+	}
+	if len(r.ChangedFields) > 0 && !slices.ContainsFunc(r.ChangedFields, func(f string) bool { return slices.Contains(req.ChangedFields, f) }) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ramk42/omi-backend-assignment/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":    "user-42",
+		"tenant": "acme",
+		"scope":  "accounts:read accounts:write",
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func TestJWTVerifier_HS256(t *testing.T) {
+	secret := []byte("secret")
+	verifier := auth.NewJWTVerifier(auth.KeySet{auth.HMACKey("", secret)}, "", "")
+
+	principal, err := verifier.Authenticate(context.Background(), sign(t, jwt.SigningMethodHS256, secret, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "user-42", principal.ID)
+	assert.Equal(t, auth.PrincipalUser, principal.Type)
+	assert.Equal(t, "acme", principal.Tenant)
+	assert.Equal(t, []string{"accounts:read", "accounts:write"}, principal.Scopes)
+}
+
+func TestJWTVerifier_IgnoresPrincipalTypeClaim(t *testing.T) {
+	secret := []byte("secret")
+	verifier := auth.NewJWTVerifier(auth.KeySet{auth.HMACKey("", secret)}, "", "")
+	claims := validClaims()
+	claims["principal_type"] = auth.PrincipalService
+
+	principal, err := verifier.Authenticate(context.Background(), sign(t, jwt.SigningMethodHS256, secret, claims))
+	require.NoError(t, err)
+	assert.Equal(t, auth.PrincipalUser, principal.Type)
+}
+
+func TestJWTVerifier_EdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	verifier := auth.NewJWTVerifier(auth.KeySet{{ID: "k1", Algorithm: "EdDSA", Material: pub}}, "", "")
+
+	_, err = verifier.Authenticate(context.Background(), sign(t, jwt.SigningMethodEdDSA, priv, validClaims()))
+	require.NoError(t, err)
+}
+
+func TestJWTVerifier_Rejects(t *testing.T) {
+	secret := []byte("secret")
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	verifier := auth.NewJWTVerifier(auth.KeySet{auth.HMACKey("", secret), {Algorithm: "EdDSA", Material: pub}}, "issuer", "")
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	noExpiry := validClaims()
+	delete(noExpiry, "exp")
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "someone-else"
+
+	withIssuer := func(claims jwt.MapClaims) jwt.MapClaims {
+		claims["iss"] = "issuer"
+		return claims
+	}
+
+	tests := map[string]string{
+		"expired":      sign(t, jwt.SigningMethodHS256, secret, withIssuer(expired)),
+		"no expiry":    sign(t, jwt.SigningMethodHS256, secret, withIssuer(noExpiry)),
+		"wrong issuer": sign(t, jwt.SigningMethodHS256, secret, wrongIssuer),
+		"wrong secret": sign(t, jwt.SigningMethodHS256, []byte("other"), withIssuer(validClaims())),
+		"alg none":     sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, withIssuer(validClaims())),
+		"malformed":    "not-a-token",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier.Authenticate(context.Background(), token)
+			assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Key is a verification key along with the JWT algorithm it is used with.
+type Key struct {
+	ID        string
+	Algorithm string
+	// Material is a []byte for HS256, a *rsa.PublicKey for RS256 and an ed25519.PublicKey for EdDSA.
+	Material any
+}
+
+// KeySet holds the keys tokens can be verified with.
+type KeySet []Key
+
+// HMACKey returns an HS256 key built from a shared secret.
+func HMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Algorithm: "HS256", Material: secret}
+}
+
+// LoadPublicKeyFile reads a PEM encoded RSA or Ed25519 public key.
+func LoadPublicKeyFile(id, path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("no PEM block found in %s", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return Key{}, err
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{ID: id, Algorithm: "RS256", Material: pub}, nil
+	case ed25519.PublicKey:
+		return Key{ID: id, Algorithm: "EdDSA", Material: pub}, nil
+	default:
+		return Key{}, fmt.Errorf("unsupported public key type %T in %s", pub, path)
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	// oct
+	K string `json:"k"`
+}
+
+// LoadJWKSFile reads a JSON Web Key Set (RFC 7517) from a local file. Only
+// signature keys of type RSA, OKP (Ed25519) and oct are kept.
+func LoadJWKSFile(path string) (KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS %s: %w", path, err)
+	}
+
+	keys := make(KeySet, 0, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.toKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS %s: %w", k.Kid, path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (k jwk) toKey() (Key, error) {
+	key := Key{ID: k.Kid, Algorithm: k.Alg}
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return Key{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return Key{}, err
+		}
+		key.Material = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.Algorithm == "" {
+			key.Algorithm = "RS256"
+		}
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return Key{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return Key{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return Key{}, errors.New("invalid Ed25519 public key size")
+		}
+		key.Material = ed25519.PublicKey(x)
+		key.Algorithm = "EdDSA"
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return Key{}, err
+		}
+		key.Material = secret
+		if key.Algorithm == "" {
+			key.Algorithm = "HS256"
+		}
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	return key, nil
+}
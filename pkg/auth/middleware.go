@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing bearer credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInsufficientScope  = errors.New("insufficient scope")
+)
+
+// FailureHook is told why a request was rejected, e.g. to report it as a
+// security event. principal is the authenticated caller, nil when unknown.
+type FailureHook func(r *http.Request, err error, principal *Principal)
+
+func (h FailureHook) report(r *http.Request, err error, principal *Principal) {
+	if h != nil {
+		h(r, err, principal)
+	}
+}
+
+// Authenticator turns the credentials of a bearer token into a principal.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Prefixed routes tokens starting with prefix to authenticator and any other token to fallback.
+func Prefixed(prefix string, authenticator, fallback Authenticator) Authenticator {
+	return prefixed{prefix: prefix, authenticator: authenticator, fallback: fallback}
+}
+
+type prefixed struct {
+	prefix        string
+	authenticator Authenticator
+	fallback      Authenticator
+}
+
+func (p prefixed) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if strings.HasPrefix(token, p.prefix) {
+		return p.authenticator.Authenticate(ctx, token)
+	}
+	return p.fallback.Authenticate(ctx, token)
+}
+
+// RequireScope forbids requests whose principal was not granted scope. onFailure may be nil.
+func RequireScope(scope string, onFailure FailureHook) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := PrincipalFromContext(r.Context())
+			if principal == nil || !principal.HasScope(scope) {
+				onFailure.report(r, fmt.Errorf("%w: missing scope %s", ErrInsufficientScope, scope), principal)
+				writeProblem(w, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Middleware rejects requests without valid bearer credentials and stores the
+// authenticated principal in the request context. onFailure may be nil.
+func Middleware(authenticator Authenticator, onFailure FailureHook) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				onFailure.report(r, ErrMissingCredentials, nil)
+				unauthorized(w, ErrMissingCredentials)
+				return
+			}
+			principal, err := authenticator.Authenticate(r.Context(), token)
+			if err != nil {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					log.Ctx(r.Context()).Error().Err(err).Msg("failed to authenticate request")
+					writeProblem(w, http.StatusServiceUnavailable)
+					return
+				}
+				onFailure.report(r, err, nil)
+				unauthorized(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// unauthorized answers with an RFC 7807 body; the detail of the failure is not
+// disclosed to the caller, only to the failure hook.
+func unauthorized(w http.ResponseWriter, err error) {
+	challenge := `Bearer`
+	if errors.Is(err, ErrInvalidCredentials) {
+		challenge = `Bearer error="invalid_token"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeProblem(w, http.StatusUnauthorized)
+}
+
+func writeProblem(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+	})
+}
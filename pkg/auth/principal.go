@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Principal types
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	ID     string
+	Type   string
+	Tenant string
+	Scopes []string
+	Roles  []string
+	// CredentialID identifies the credential used to authenticate, such as an API key id.
+	CredentialID string
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying the principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated principal, nil for anonymous requests.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
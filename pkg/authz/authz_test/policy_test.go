@@ -0,0 +1,39 @@
+package authz_test
+
+import (
+	"github.com/ramk42/omi-backend-assignment/pkg/authz"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	policy := &authz.Policy{
+		Roles: map[string][]string{
+			"admin":  {"account.*"},
+			"viewer": {"account.list", "account.read"},
+		},
+		Bindings:         map[string][]string{"service:billing": {"viewer"}},
+		OwnerPermissions: []string{"account.read", "account.update"},
+	}
+
+	tests := []struct {
+		name       string
+		subject    authz.Subject
+		action     string
+		resourceID string
+		allowed    bool
+	}{
+		{"admin wildcard", authz.Subject{ID: "u1", Type: "user", Roles: []string{"admin"}}, "account.delete", "a1", true},
+		{"viewer cannot update", authz.Subject{ID: "u1", Type: "user", Roles: []string{"viewer"}}, "account.update", "a1", false},
+		{"owner edits self", authz.Subject{ID: "a1", Type: "user"}, "account.update", "a1", true},
+		{"owner cannot delete self", authz.Subject{ID: "a1", Type: "user"}, "account.delete", "a1", false},
+		{"owner rule is for users only", authz.Subject{ID: "a1", Type: "service"}, "account.update", "a1", false},
+		{"binding grants role", authz.Subject{ID: "billing", Type: "service"}, "account.read", "a1", true},
+		{"no role", authz.Subject{ID: "u2", Type: "user"}, "account.list", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, policy.Authorize(tt.subject, tt.action, tt.resourceID).Allowed)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Policy grants permissions to roles. Permissions are action names such as
+// "account.update"; "account.*" grants every action on accounts and "*" every action.
+type Policy struct {
+	// Roles maps a role name to the permissions it grants.
+	Roles map[string][]string `json:"roles"`
+	// DefaultRoles are granted to every authenticated subject.
+	DefaultRoles []string `json:"default_roles"`
+	// Bindings grants roles to subjects identified as "<type>:<id>", e.g. "service:billing".
+	Bindings map[string][]string `json:"bindings"`
+	// OwnerPermissions are granted to a user on the resource whose id is its own.
+	OwnerPermissions []string `json:"owner_permissions"`
+}
+
+// Subject is the caller a decision is made for.
+type Subject struct {
+	ID    string
+	Type  string
+	Roles []string
+}
+
+// Decision is the outcome of an authorization check along with its reason.
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// LoadFile reads a JSON policy.
+func LoadFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	if err := policy.checkRoles(policy.DefaultRoles); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	for _, roles := range policy.Bindings {
+		if err := policy.checkRoles(roles); err != nil {
+			return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+		}
+	}
+	return &policy, nil
+}
+
+// Authorize decides whether subject may perform action on the resource with
+// the given id (empty for collection actions).
+func (p *Policy) Authorize(subject Subject, action, resourceID string) Decision {
+	for _, role := range p.rolesOf(subject) {
+		if grants(p.Roles[role], action) {
+			return Decision{Allowed: true, Reason: "role:" + role}
+		}
+	}
+	if subject.Type == "user" && resourceID != "" && resourceID == subject.ID && grants(p.OwnerPermissions, action) {
+		return Decision{Allowed: true, Reason: "owner"}
+	}
+	return Decision{Allowed: false, Reason: "no role grants " + action}
+}
+
+func (p *Policy) rolesOf(subject Subject) []string {
+	roles := slices.Concat(subject.Roles, p.DefaultRoles, p.Bindings[subject.Type+":"+subject.ID])
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
+
+func grants(permissions []string, action string) bool {
+	for _, permission := range permissions {
+		if permission == "*" || permission == action {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(permission, "*"); ok && strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) checkRoles(roles []string) error {
+	for _, role := range roles {
+		if _, ok := p.Roles[role]; !ok {
+			return fmt.Errorf("unknown role %q", role)
+		}
+	}
+	return nil
+}
@@ -34,3 +34,11 @@ func MustGetEnv[T any](key string) T {
 
 	return result.(T)
 }
+
+// GetEnv returns the value of the environment variable key, or fallback when it is not set.
+func GetEnv[T any](key string, fallback T) T {
+	if _, exists := os.LookupEnv(key); !exists {
+		return fallback
+	}
+	return MustGetEnv[T](key)
+}
@@ -0,0 +1,91 @@
+package logsreporting
+
+import (
+	"encoding/json"
+)
+
+// Actor is who performed the action. It is serialized as a flat JSON object of
+// strings, the Extra entries next to the named fields.
+type Actor struct {
+	Type      string
+	ID        string
+	Display   string
+	Tenant    string
+	IP        string
+	UserAgent string
+	// Extra holds the other attributes of the actor, e.g. the key_id and scopes of an API key.
+	Extra map[string]string
+}
+
+func (a Actor) fields() []field {
+	return []field{
+		{"type", a.Type},
+		{"id", a.ID},
+		{"display", a.Display},
+		{"tenant", a.Tenant},
+		{"ip", a.IP},
+		{"user_agent", a.UserAgent},
+	}
+}
+
+func (a *Actor) set(key, value string) {
+	switch key {
+	case "type":
+		a.Type = value
+	case "id":
+		a.ID = value
+	case "display":
+		a.Display = value
+	case "tenant":
+		a.Tenant = value
+	case "ip":
+		a.IP = value
+	case "user_agent":
+		a.UserAgent = value
+	default:
+		if a.Extra == nil {
+			a.Extra = map[string]string{}
+		}
+		a.Extra[key] = value
+	}
+}
+
+// Known reports whether the actor is identified, i.e. has a type.
+func (a Actor) Known() bool {
+	return a.Type != ""
+}
+
+func (a Actor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(flatten(a.fields(), a.Extra))
+}
+
+func (a *Actor) UnmarshalJSON(data []byte) error {
+	var entries map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	*a = Actor{}
+	for key, value := range entries {
+		a.set(key, value)
+	}
+	return nil
+}
+
+// field is a named field of a flat JSON object.
+type field struct {
+	key, value string
+}
+
+// flatten merges the non-empty fields with the extra entries, the fields taking precedence.
+func flatten(fields []field, extra map[string]string) map[string]string {
+	entries := make(map[string]string, len(fields)+len(extra))
+	for key, value := range extra {
+		entries[key] = value
+	}
+	for _, f := range fields {
+		if f.value != "" {
+			entries[f.key] = f.value
+		}
+	}
+	return entries
+}
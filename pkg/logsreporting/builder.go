@@ -0,0 +1,115 @@
+package logsreporting
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// SpecVersion is the version of the event format produced, the last of the
+// versions the consumers can upcast from.
+const SpecVersion = "1.1"
+
+// ErrInvalidEvent is returned for an event missing required fields.
+var ErrInvalidEvent = errors.New("invalid audit event")
+
+// Builder builds an audit event, checking that it is complete.
+type Builder struct {
+	event AuditLog
+}
+
+// NewEvent starts an event of eventType emitted by source.
+func NewEvent(eventType, source string) *Builder {
+	return &Builder{event: AuditLog{SpecVersion: SpecVersion, Type: eventType, Source: source}}
+}
+
+// ID sets the id of the event, a random UUID by default.
+func (b *Builder) ID(id string) *Builder {
+	b.event.ID = id
+	return b
+}
+
+// Subject sets the subject of the event, "event:<resource type>[:<resource id>]" by default.
+func (b *Builder) Subject(subject string) *Builder {
+	b.event.Subject = subject
+	return b
+}
+
+// Timestamp sets when the action happened, the time of Build by default.
+func (b *Builder) Timestamp(timestamp time.Time) *Builder {
+	b.event.Timestamp = timestamp
+	return b
+}
+
+func (b *Builder) Actor(actor Actor) *Builder {
+	b.event.Actor = actor
+	return b
+}
+
+func (b *Builder) Action(action string) *Builder {
+	b.event.Action = action
+	return b
+}
+
+func (b *Builder) Resource(resource Resource) *Builder {
+	b.event.Resource = resource
+	return b
+}
+
+func (b *Builder) Context(context Context) *Builder {
+	b.event.Context = context
+	return b
+}
+
+func (b *Builder) Changes(changes []Change) *Builder {
+	b.event.Changes = changes
+	return b
+}
+
+// Build returns the event, or an error wrapping ErrInvalidEvent when required fields are missing.
+func (b *Builder) Build() (*AuditLog, error) {
+	event := b.event
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.Subject == "" && event.Resource.Type != "" {
+		event.Subject = "event:" + event.Resource.Type
+		if event.Resource.ID != "" {
+			event.Subject += ":" + event.Resource.ID
+		}
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Validate checks that the required fields of the event are set.
+func (e *AuditLog) Validate() error {
+	var missing []string
+	for _, required := range []struct{ name, value string }{
+		{"spec_version", e.SpecVersion},
+		{"id", e.ID},
+		{"source", e.Source},
+		{"type", e.Type},
+		{"action", e.Action},
+		{"actor.type", e.Actor.Type},
+		{"resource.type", e.Resource.Type},
+	} {
+		if required.value == "" {
+			missing = append(missing, required.name)
+		}
+	}
+	if e.Timestamp.IsZero() {
+		missing = append(missing, "timestamp")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalidEvent, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package logsreporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"strings"
+	"time"
+)
+
+// Content modes, how an event is laid out in a NATS message.
+const (
+	// ContentModeStructured publishes a CloudEvents 1.0 JSON document.
+	ContentModeStructured = "structured"
+	// ContentModeBinary publishes the CloudEvents attributes in ce-* headers and the data as the body.
+	ContentModeBinary = "binary"
+	// ContentModeLegacy publishes the AuditLog JSON, as consumers predating CloudEvents expect.
+	ContentModeLegacy = "legacy"
+)
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification implemented.
+const CloudEventsSpecVersion = "1.0"
+
+const (
+	headerContentType       = "Content-Type"
+	headerPrefix            = "ce-"
+	contentTypeJSON         = "application/json"
+	contentTypeCloudEvents  = "application/cloudevents+json"
+	cloudEventsTimeEncoding = time.RFC3339Nano
+)
+
+// cloudEvent is the structured JSON representation of an event.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// eventData is the data of an event, everything but its CloudEvents attributes.
+type eventData struct {
+	Actor    Actor    `json:"actor"`
+	Action   string   `json:"action"`
+	Resource Resource `json:"resource"`
+	Context  Context  `json:"metadata"`
+	Changes  []Change `json:"changes,omitempty"`
+}
+
+// Encoding is how events are laid out in NATS messages.
+type Encoding struct {
+	// ContentMode is one of the ContentMode* constants.
+	ContentMode string
+	// Format is one of the Format* constants, FormatJSON when empty. The
+	// protobuf format carries the whole event as the body, which the
+	// structured content mode, a JSON document, cannot.
+	Format string
+}
+
+func (e Encoding) validate() error {
+	switch e.ContentMode {
+	case ContentModeStructured, ContentModeBinary, ContentModeLegacy:
+	default:
+		return fmt.Errorf("unknown content mode %q", e.ContentMode)
+	}
+	switch e.Format {
+	case "", FormatJSON:
+	case FormatProtobuf:
+		if e.ContentMode == ContentModeStructured {
+			return fmt.Errorf("the %s format cannot be used with the %s content mode", FormatProtobuf, ContentModeStructured)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", e.Format)
+	}
+	return nil
+}
+
+// EncodeMessage lays out the event in a message on subject according to encoding.
+func EncodeMessage(subject string, event *AuditLog, encoding Encoding) (*nats.Msg, error) {
+	if err := encoding.validate(); err != nil {
+		return nil, err
+	}
+	msg := nats.NewMsg(subject)
+	if encoding.Format == FormatProtobuf {
+		data, err := MarshalProtobuf(event)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = data
+		msg.Header.Set(headerContentType, contentTypeProtobuf)
+		if encoding.ContentMode == ContentModeBinary {
+			setAttributeHeaders(msg, toCloudEvent(event, nil))
+		}
+		return msg, nil
+	}
+	if encoding.ContentMode == ContentModeLegacy {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = data
+		msg.Header.Set(headerContentType, contentTypeJSON)
+		return msg, nil
+	}
+
+	data, err := json.Marshal(eventData{
+		Actor:    event.Actor,
+		Action:   event.Action,
+		Resource: event.Resource,
+		Context:  event.Context,
+		Changes:  event.Changes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ce := toCloudEvent(event, data)
+	switch encoding.ContentMode {
+	case ContentModeStructured:
+		msg.Header.Set(headerContentType, contentTypeCloudEvents)
+		msg.Data, err = json.Marshal(ce)
+		if err != nil {
+			return nil, err
+		}
+	case ContentModeBinary:
+		msg.Header.Set(headerContentType, ce.DataContentType)
+		setAttributeHeaders(msg, ce)
+		msg.Data = data
+	}
+	return msg, nil
+}
+
+func toCloudEvent(event *AuditLog, data json.RawMessage) cloudEvent {
+	ce := cloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              event.ID,
+		Source:          event.Source,
+		Type:            event.Type,
+		Subject:         event.Subject,
+		DataContentType: contentTypeJSON,
+		DataSchema:      schemaIDOf(event.SpecVersion),
+		Data:            data,
+	}
+	if !event.Timestamp.IsZero() {
+		ce.Time = event.Timestamp.UTC().Format(cloudEventsTimeEncoding)
+	}
+	return ce
+}
+
+// setAttributeHeaders sets the ce-* headers of the binary content mode.
+func setAttributeHeaders(msg *nats.Msg, ce cloudEvent) {
+	for attribute, value := range map[string]string{
+		"specversion": ce.SpecVersion,
+		"id":          ce.ID,
+		"source":      ce.Source,
+		"type":        ce.Type,
+		"subject":     ce.Subject,
+		"time":        ce.Time,
+		"dataschema":  ce.DataSchema,
+	} {
+		if value != "" {
+			msg.Header.Set(headerPrefix+attribute, value)
+		}
+	}
+}
+
+// DecodeMessage reads an event laid out in any of the encodings, picking the
+// decoder by the Content-Type header: protobuf when it says so; otherwise
+// binary when the message has a ce-specversion header, structured when its
+// body is a CloudEvents document, legacy JSON when it is not.
+func DecodeMessage(msg *nats.Msg) (*AuditLog, error) {
+	if contentType := msg.Header.Get(headerContentType); isProtobuf(contentType) {
+		if contentType != contentTypeProtobuf && strings.Contains(contentType, "proto=") {
+			return nil, fmt.Errorf("%w: unsupported protobuf schema %q", ErrInvalidEvent, contentType)
+		}
+		return UnmarshalProtobuf(msg.Data)
+	}
+	if specVersion := msg.Header.Get(headerPrefix + "specversion"); specVersion != "" {
+		return decodeBinary(msg)
+	}
+
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	if err := json.Unmarshal(msg.Data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.SpecVersion == "" && !strings.HasPrefix(msg.Header.Get(headerContentType), contentTypeCloudEvents) {
+		var event AuditLog
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return nil, err
+		}
+		return &event, nil
+	}
+
+	var ce cloudEvent
+	if err := json.Unmarshal(msg.Data, &ce); err != nil {
+		return nil, err
+	}
+	return fromCloudEvent(ce)
+}
+
+func decodeBinary(msg *nats.Msg) (*AuditLog, error) {
+	return fromCloudEvent(cloudEvent{
+		SpecVersion:     msg.Header.Get(headerPrefix + "specversion"),
+		ID:              msg.Header.Get(headerPrefix + "id"),
+		Source:          msg.Header.Get(headerPrefix + "source"),
+		Type:            msg.Header.Get(headerPrefix + "type"),
+		Subject:         msg.Header.Get(headerPrefix + "subject"),
+		Time:            msg.Header.Get(headerPrefix + "time"),
+		DataContentType: msg.Header.Get(headerContentType),
+		DataSchema:      msg.Header.Get(headerPrefix + "dataschema"),
+		Data:            msg.Data,
+	})
+}
+
+func fromCloudEvent(ce cloudEvent) (*AuditLog, error) {
+	if ce.SpecVersion != CloudEventsSpecVersion {
+		return nil, fmt.Errorf("%w: unsupported CloudEvents specversion %q", ErrInvalidEvent, ce.SpecVersion)
+	}
+	if ce.ID == "" || ce.Source == "" || ce.Type == "" {
+		return nil, fmt.Errorf("%w: missing CloudEvents id, source or type", ErrInvalidEvent)
+	}
+	if ce.DataContentType != "" && !strings.HasPrefix(ce.DataContentType, contentTypeJSON) {
+		return nil, fmt.Errorf("%w: unsupported datacontenttype %q", ErrInvalidEvent, ce.DataContentType)
+	}
+
+	// the spec_version of the event is named by its dataschema, the events
+	// published before it was set are of the first version
+	specVersion := versions[0].specVersion
+	if ce.DataSchema != "" {
+		var ok bool
+		if specVersion, ok = specVersionOfSchema(ce.DataSchema); !ok {
+			return nil, fmt.Errorf("%w: unsupported dataschema %q", ErrInvalidEvent, ce.DataSchema)
+		}
+	}
+
+	event := &AuditLog{
+		SpecVersion: specVersion,
+		ID:          ce.ID,
+		Source:      ce.Source,
+		Type:        ce.Type,
+		Subject:     ce.Subject,
+	}
+	if ce.Time != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, ce.Time)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid time: %v", ErrInvalidEvent, err)
+		}
+		event.Timestamp = timestamp
+	}
+	if len(ce.Data) > 0 {
+		var data eventData
+		if err := json.Unmarshal(ce.Data, &data); err != nil {
+			return nil, err
+		}
+		event.Actor = data.Actor
+		event.Action = data.Action
+		event.Resource = data.Resource
+		event.Context = data.Context
+		event.Changes = data.Changes
+	}
+	return event, nil
+}
+
+func isProtobuf(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/protobuf") || strings.HasPrefix(contentType, "application/x-protobuf")
+}
@@ -0,0 +1,114 @@
+package logsreporting
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+)
+
+// Context describes the request an event originates from. It is serialized as
+// a flat JSON object of strings, the Extra entries next to the named fields.
+type Context struct {
+	RequestID      string
+	IP             string
+	UserAgent      string
+	Method         string
+	Protocol       string
+	ResponseStatus int
+	Outcome        string
+	// Extra holds the other entries, e.g. the reason of a denial or the sample rate of the event.
+	Extra map[string]string
+}
+
+// ClientIP returns the host of a request's RemoteAddr, "ip:port" unless a
+// middleware such as chi's RealIP replaced it with a bare ip, which is
+// returned as is.
+func ClientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// ContextFromMetadata returns the context described by flat metadata entries.
+func ContextFromMetadata(metadata map[string]string) Context {
+	var c Context
+	for key, value := range metadata {
+		c.Set(key, value)
+	}
+	return c
+}
+
+func (c Context) fields() []field {
+	status := ""
+	if c.ResponseStatus != 0 {
+		status = strconv.Itoa(c.ResponseStatus)
+	}
+	return []field{
+		{"request_id", c.RequestID},
+		{"ip", c.IP},
+		{"user_agent", c.UserAgent},
+		{"method", c.Method},
+		{"protocol", c.Protocol},
+		{"response_status", status},
+		{"outcome", c.Outcome},
+	}
+}
+
+// Set sets the entry of key, be it a named field or an extra one.
+func (c *Context) Set(key, value string) {
+	switch key {
+	case "request_id":
+		c.RequestID = value
+	case "ip":
+		c.IP = value
+	case "user_agent":
+		c.UserAgent = value
+	case "method":
+		c.Method = value
+	case "protocol":
+		c.Protocol = value
+	case "response_status":
+		if status, err := strconv.Atoi(value); err == nil {
+			c.ResponseStatus = status
+			return
+		}
+		c.ResponseStatus = 0
+		c.setExtra(key, value)
+	case "outcome":
+		c.Outcome = value
+	default:
+		c.setExtra(key, value)
+	}
+}
+
+func (c *Context) setExtra(key, value string) {
+	if c.Extra == nil {
+		c.Extra = map[string]string{}
+	}
+	c.Extra[key] = value
+}
+
+// Get returns the entry of key, be it a named field or an extra one.
+func (c Context) Get(key string) string {
+	return c.Metadata()[key]
+}
+
+// Metadata returns the context as flat entries, as serialized.
+func (c Context) Metadata() map[string]string {
+	return flatten(c.fields(), c.Extra)
+}
+
+func (c Context) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Metadata())
+}
+
+func (c *Context) UnmarshalJSON(data []byte) error {
+	var metadata map[string]string
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return err
+	}
+	*c = ContextFromMetadata(metadata)
+	return nil
+}
@@ -0,0 +1,126 @@
+package logsreporting
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const dedupFlushInterval = time.Second
+
+// DefaultDedupMaxPending is the number of collapsed events held when none is configured.
+const DefaultDedupMaxPending = 10000
+
+// Deduplicator collapses the access events of an actor on a resource within a
+// window into the first of them, published when the window closes with the
+// number of accesses and the time of the first and last one.
+//
+// Pending events are kept in memory: they are flushed when Run stops, but lost
+// if the process crashes. At most maxPending of them are held, a new one
+// beyond that flushing an arbitrary pending event before its window closes.
+type Deduplicator struct {
+	producer   Producer
+	maxPending int
+	mu         sync.Mutex
+	pending    map[string]*collapsedAccess
+}
+
+type collapsedAccess struct {
+	event    *AuditLog
+	count    int
+	lastSeen time.Time
+	closesAt time.Time
+}
+
+// NewDeduplicator holds at most maxPending collapsed events, DefaultDedupMaxPending when not positive.
+func NewDeduplicator(producer Producer, maxPending int) *Deduplicator {
+	if maxPending <= 0 {
+		maxPending = DefaultDedupMaxPending
+	}
+	return &Deduplicator{producer: producer, maxPending: maxPending, pending: map[string]*collapsedAccess{}}
+}
+
+// Add records an access event, collapsed with the ones of the same actor,
+// action and resource for window. It only publishes, with ctx, when the
+// pending events reached their maximum.
+func (d *Deduplicator) Add(ctx context.Context, event *AuditLog, window time.Duration) {
+	d.AddKeyed(ctx, dedupKey(event), event, window)
+}
+
+// AddKeyed records an event, collapsed with the ones of the same key for window.
+func (d *Deduplicator) AddKeyed(ctx context.Context, key string, event *AuditLog, window time.Duration) {
+	if evicted := d.add(key, event, window); evicted != nil {
+		d.publish(ctx, evicted)
+	}
+}
+
+func (d *Deduplicator) add(key string, event *AuditLog, window time.Duration) *collapsedAccess {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if access, ok := d.pending[key]; ok {
+		access.count++
+		access.lastSeen = event.Timestamp
+		return nil
+	}
+
+	var evicted *collapsedAccess
+	if len(d.pending) >= d.maxPending {
+		for key, access := range d.pending {
+			evicted = access
+			delete(d.pending, key)
+			break
+		}
+	}
+	d.pending[key] = &collapsedAccess{event: event, count: 1, lastSeen: event.Timestamp, closesAt: time.Now().Add(window)}
+	return evicted
+}
+
+// Run publishes the events whose window closed until ctx is canceled, then
+// publishes all the pending ones.
+func (d *Deduplicator) Run(ctx context.Context) {
+	ticker := time.NewTicker(dedupFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is over, the events are handed over with a fresh one
+			d.flush(context.WithoutCancel(ctx), time.Time{})
+			return
+		case now := <-ticker.C:
+			d.flush(ctx, now)
+		}
+	}
+}
+
+// flush publishes the events whose window closed before now, all of them when now is zero.
+func (d *Deduplicator) flush(ctx context.Context, now time.Time) {
+	var closed []*collapsedAccess
+	d.mu.Lock()
+	for key, access := range d.pending {
+		if now.IsZero() || !now.Before(access.closesAt) {
+			closed = append(closed, access)
+			delete(d.pending, key)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, access := range closed {
+		d.publish(ctx, access)
+	}
+}
+
+func (d *Deduplicator) publish(ctx context.Context, access *collapsedAccess) {
+	event := access.event
+	event.Context.Set("access_count", strconv.Itoa(access.count))
+	event.Context.Set("first_seen", event.Timestamp.Format(time.RFC3339Nano))
+	event.Context.Set("last_seen", access.lastSeen.Format(time.RFC3339Nano))
+	if err := d.producer.Publish(ctx, event); err != nil {
+		log.Error().Err(err).Str("event_id", event.ID).Msg("failure to publish access event")
+	}
+}
+
+func dedupKey(event *AuditLog) string {
+	return event.Actor.Tenant + "|" + event.Actor.Type + ":" + event.Actor.ID + "|" + event.Action + "|" + event.Resource.ID
+}
@@ -0,0 +1,147 @@
+package logsreporting
+
+import (
+	"context"
+	"sync"
+)
+
+type draftKey struct{}
+
+// Draft is the audit event of the request being served. The audit middleware
+// opens it, the layers below enrich it with what they learn while serving the
+// request, and it ends up either recorded with the change it describes (outbox)
+// or published once the response is sent.
+//
+// All methods are safe to call on a nil Draft, so code paths that are not
+// audited do not need to check for one.
+type Draft struct {
+	mu         sync.Mutex
+	compose    ComposeFunc
+	resourceID string
+	action     string
+	changes    []Change
+	metadata   map[string]string
+	recorded   bool
+	unchanged  bool
+}
+
+// ComposeFunc builds the event from what is known of the request, reqCtx
+// holding the annotations. action is empty unless overridden with SetAction. A
+// nil event means the request is not audited.
+type ComposeFunc func(resourceID, action string, changes []Change, reqCtx Context) *AuditLog
+
+// NewDraft opens a draft whose event is shaped by compose.
+func NewDraft(resourceID string, compose ComposeFunc) *Draft {
+	return &Draft{compose: compose, resourceID: resourceID, metadata: map[string]string{}}
+}
+
+// ContextWithDraft returns a copy of ctx carrying the draft.
+func ContextWithDraft(ctx context.Context, draft *Draft) context.Context {
+	return context.WithValue(ctx, draftKey{}, draft)
+}
+
+// DraftFromContext returns the draft of the current request, nil when it is not audited.
+func DraftFromContext(ctx context.Context) *Draft {
+	draft, _ := ctx.Value(draftKey{}).(*Draft)
+	return draft
+}
+
+// SetResourceID sets the id of a resource that is not part of the route, such as one assigned on creation.
+func (d *Draft) SetResourceID(id string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resourceID = id
+}
+
+// SetAction overrides the action derived from the request, for operations
+// that do not map onto a plain create/read/update/delete.
+func (d *Draft) SetAction(action string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.action = action
+}
+
+// SetChanges records the field-level diff of the mutated resource.
+func (d *Draft) SetChanges(changes []Change) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.changes = changes
+}
+
+// Annotate adds a metadata entry to the event.
+func (d *Draft) Annotate(key, value string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.metadata[key] = value
+}
+
+// Event composes the event with everything known so far, plus the given
+// metadata. It returns nil when the request is not to be audited.
+func (d *Draft) Event(extraMetadata map[string]string) *AuditLog {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	metadata := make(map[string]string, len(d.metadata)+len(extraMetadata))
+	for k, v := range d.metadata {
+		metadata[k] = v
+	}
+	for k, v := range extraMetadata {
+		metadata[k] = v
+	}
+	return d.compose(d.resourceID, d.action, d.changes, ContextFromMetadata(metadata))
+}
+
+// MarkRecorded flags the event as durably recorded, so it must not be published again.
+func (d *Draft) MarkRecorded() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.recorded = true
+}
+
+// Recorded reports whether the event has already been durably recorded.
+func (d *Draft) Recorded() bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.recorded
+}
+
+// MarkUnchanged flags a mutation that completed without changing anything, such
+// as a patch setting the current values, so it has no change to record.
+func (d *Draft) MarkUnchanged() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unchanged = true
+}
+
+// Unchanged reports whether the request was flagged as changing nothing.
+func (d *Draft) Unchanged() bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.unchanged
+}
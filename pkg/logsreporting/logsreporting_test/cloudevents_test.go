@@ -0,0 +1,119 @@
+package logsreporting_test
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func sampleEvent(t *testing.T) *logsreporting.AuditLog {
+	event, err := logsreporting.NewEvent(logsreporting.EventTypeChange, "backend.api").
+		Timestamp(time.Date(2025, 1, 1, 10, 0, 0, 123456789, time.UTC)).
+		Actor(logsreporting.Actor{ID: "alice", Type: "user", Extra: map[string]string{"scopes": "accounts:read"}}).
+		Action("account.update").
+		Resource(logsreporting.Resource{ID: "42", Type: "account", Attributes: map[string]any{"name": "Ada"}}).
+		Context(logsreporting.Context{RequestID: "req-1", ResponseStatus: 204}).
+		Changes([]logsreporting.Change{{Field: "name", Old: "Grace", New: "Ada"}}).
+		Build()
+	require.NoError(t, err)
+	return event
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+	for _, mode := range []string{logsreporting.ContentModeStructured, logsreporting.ContentModeBinary, logsreporting.ContentModeLegacy} {
+		t.Run(mode, func(t *testing.T) {
+			event := sampleEvent(t)
+			msg, err := logsreporting.EncodeMessage("audit_logs", event, logsreporting.Encoding{ContentMode: mode})
+			require.NoError(t, err)
+
+			decoded, err := logsreporting.DecodeMessage(msg)
+			require.NoError(t, err)
+			assert.Equal(t, event, decoded)
+		})
+	}
+}
+
+func TestEncodeMessage_Structured(t *testing.T) {
+	msg, err := logsreporting.EncodeMessage("audit_logs", sampleEvent(t), logsreporting.Encoding{ContentMode: logsreporting.ContentModeStructured})
+	require.NoError(t, err)
+
+	assert.Equal(t, "application/cloudevents+json", msg.Header.Get("Content-Type"))
+	var ce map[string]any
+	require.NoError(t, json.Unmarshal(msg.Data, &ce))
+	assert.Equal(t, "1.0", ce["specversion"])
+	assert.Equal(t, "2025-01-01T10:00:00.123456789Z", ce["time"])
+	assert.Equal(t, "application/json", ce["datacontenttype"])
+	assert.Equal(t, "account.update", ce["data"].(map[string]any)["action"])
+	assert.NotContains(t, ce, "spec_version")
+	assert.NotContains(t, ce, "timestamp")
+}
+
+func TestEncodeMessage_Binary(t *testing.T) {
+	event := sampleEvent(t)
+	msg, err := logsreporting.EncodeMessage("audit_logs", event, logsreporting.Encoding{ContentMode: logsreporting.ContentModeBinary})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.0", msg.Header.Get("ce-specversion"))
+	assert.Equal(t, event.ID, msg.Header.Get("ce-id"))
+	assert.Equal(t, "backend.api", msg.Header.Get("ce-source"))
+	assert.Equal(t, logsreporting.EventTypeChange, msg.Header.Get("ce-type"))
+	assert.Equal(t, "event:account:42", msg.Header.Get("ce-subject"))
+	assert.Equal(t, "application/json", msg.Header.Get("Content-Type"))
+	var data map[string]any
+	require.NoError(t, json.Unmarshal(msg.Data, &data))
+	assert.Equal(t, "account.update", data["action"])
+	assert.NotContains(t, data, "id")
+}
+
+func TestEncodeMessage_RejectsUnknownMode(t *testing.T) {
+	_, err := logsreporting.EncodeMessage("audit_logs", sampleEvent(t), logsreporting.Encoding{ContentMode: "xml"})
+	assert.Error(t, err)
+
+	_, err = logsreporting.EncodeMessage("audit_logs", sampleEvent(t), logsreporting.Encoding{ContentMode: logsreporting.ContentModeStructured, Format: logsreporting.FormatProtobuf})
+	assert.Error(t, err, "a structured event is a JSON document")
+}
+
+func TestDecodeMessage_ForeignStructuredEvent(t *testing.T) {
+	// as produced by another CloudEvents SDK: no Content-Type header, no data
+	msg := nats.NewMsg("audit_logs")
+	msg.Data = []byte(`{"specversion":"1.0","id":"e1","source":"/billing","type":"invoice.paid"}`)
+
+	event, err := logsreporting.DecodeMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "e1", event.ID)
+	assert.Equal(t, "/billing", event.Source)
+	assert.Equal(t, "invoice.paid", event.Type)
+}
+
+func TestDecodeMessage_Rejects(t *testing.T) {
+	tests := map[string]func(msg *nats.Msg){
+		"unknown specversion": func(msg *nats.Msg) {
+			msg.Data = []byte(`{"specversion":"0.3","id":"e1","source":"/s","type":"t"}`)
+		},
+		"missing id": func(msg *nats.Msg) {
+			msg.Header.Set("ce-specversion", "1.0")
+			msg.Header.Set("ce-source", "/s")
+			msg.Header.Set("ce-type", "t")
+		},
+		"non json data": func(msg *nats.Msg) {
+			msg.Header.Set("ce-specversion", "1.0")
+			msg.Header.Set("ce-id", "e1")
+			msg.Header.Set("ce-source", "/s")
+			msg.Header.Set("ce-type", "t")
+			msg.Header.Set("Content-Type", "application/xml")
+			msg.Data = []byte(`<event/>`)
+		},
+	}
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			msg := nats.NewMsg("audit_logs")
+			setup(msg)
+			_, err := logsreporting.DecodeMessage(msg)
+			assert.ErrorIs(t, err, logsreporting.ErrInvalidEvent)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package logsreporting_test
+
+import (
+	"context"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingProducer struct {
+	mu     sync.Mutex
+	events []*logsreporting.AuditLog
+}
+
+func (r *recordingProducer) Publish(_ context.Context, event *logsreporting.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func accessEvent(id, actorID string, at time.Time) *logsreporting.AuditLog {
+	return &logsreporting.AuditLog{
+		ID:        id,
+		Type:      logsreporting.EventTypeAccess,
+		Timestamp: at,
+		Actor:     logsreporting.Actor{ID: actorID, Type: "user"},
+		Action:    "account.read",
+		Resource:  logsreporting.Resource{ID: "42", Type: "account"},
+	}
+}
+
+func TestDeduplicator_CollapsesAccessesOfAnActor(t *testing.T) {
+	producer := &recordingProducer{}
+	dedup := logsreporting.NewDeduplicator(producer, 0)
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	dedup.Add(context.Background(), accessEvent("1", "alice", start), time.Hour)
+	dedup.Add(context.Background(), accessEvent("2", "alice", start.Add(time.Minute)), time.Hour)
+	dedup.Add(context.Background(), accessEvent("3", "alice", start.Add(2*time.Minute)), time.Hour)
+	dedup.Add(context.Background(), accessEvent("4", "bob", start.Add(time.Minute)), time.Hour)
+
+	// stopping flushes the pending events, whatever their window
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dedup.Run(ctx)
+
+	require.Len(t, producer.events, 2)
+	byID := map[string]*logsreporting.AuditLog{}
+	for _, event := range producer.events {
+		byID[event.ID] = event
+	}
+	require.Contains(t, byID, "1")
+	assert.Equal(t, "3", byID["1"].Context.Get("access_count"))
+	assert.Equal(t, start.Format(time.RFC3339Nano), byID["1"].Context.Get("first_seen"))
+	assert.Equal(t, start.Add(2*time.Minute).Format(time.RFC3339Nano), byID["1"].Context.Get("last_seen"))
+	require.Contains(t, byID, "4")
+	assert.Equal(t, "1", byID["4"].Context.Get("access_count"))
+}
+
+func TestDeduplicator_PublishesOnceTheWindowCloses(t *testing.T) {
+	producer := &recordingProducer{}
+	dedup := logsreporting.NewDeduplicator(producer, 0)
+	dedup.Add(context.Background(), accessEvent("1", "alice", time.Now()), time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dedup.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		producer.mu.Lock()
+		defer producer.mu.Unlock()
+		return len(producer.events) == 1
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestDeduplicator_FlushesEarlyWhenFull(t *testing.T) {
+	producer := &recordingProducer{}
+	dedup := logsreporting.NewDeduplicator(producer, 2)
+	now := time.Now()
+
+	dedup.Add(context.Background(), accessEvent("1", "alice", now), time.Hour)
+	dedup.Add(context.Background(), accessEvent("2", "bob", now), time.Hour)
+	// an access of a pending key is still collapsed
+	dedup.Add(context.Background(), accessEvent("3", "alice", now), time.Hour)
+	assert.Empty(t, producer.events)
+
+	dedup.Add(context.Background(), accessEvent("4", "carol", now), time.Hour)
+	require.Len(t, producer.events, 1, "one pending event is flushed to make room")
+	flushed := producer.events[0]
+	assert.Contains(t, []string{"1", "2"}, flushed.ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dedup.Run(ctx)
+	require.Len(t, producer.events, 3)
+	counts := map[string]string{}
+	for _, event := range producer.events {
+		counts[event.ID] = event.Context.Get("access_count")
+	}
+	assert.Equal(t, map[string]string{"1": "2", "2": "1", "4": "1"}, counts)
+}
@@ -0,0 +1,81 @@
+package logsreporting_test
+
+import (
+	"encoding/json"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// an event as published before the actor, resource and metadata were typed
+const untypedEvent = `{
+  "spec_version": "1.0",
+  "id": "5f0c1d2e-0000-4000-8000-000000000001",
+  "source": "backend.api",
+  "type": "audit.event",
+  "subject": "event:account:42",
+  "timestamp": "2025-01-01T10:00:00Z",
+  "actor": {"id": "key-1", "type": "api_key", "tenant": "acme", "key_id": "k1", "scopes": "accounts:read apikeys:admin"},
+  "action": "account.update",
+  "resource": {"id": "42", "type": "account", "attributes": {"name": "Ada"}},
+  "metadata": {"request_id": "req-1", "protocol": "HTTP/1.1", "response_status": "204", "outcome": "success", "authz_reason": "owner"},
+  "changes": [{"field": "name", "old": "Grace", "new": "Ada"}]
+}`
+
+func TestAuditLog_WireCompatibility(t *testing.T) {
+	var event logsreporting.AuditLog
+	require.NoError(t, json.Unmarshal([]byte(untypedEvent), &event))
+
+	assert.Equal(t, logsreporting.Actor{
+		ID:     "key-1",
+		Type:   "api_key",
+		Tenant: "acme",
+		Extra:  map[string]string{"key_id": "k1", "scopes": "accounts:read apikeys:admin"},
+	}, event.Actor)
+	assert.Equal(t, logsreporting.Resource{ID: "42", Type: "account", Attributes: map[string]any{"name": "Ada"}}, event.Resource)
+	assert.Equal(t, "req-1", event.Context.RequestID)
+	assert.Equal(t, 204, event.Context.ResponseStatus)
+	assert.Equal(t, "success", event.Context.Outcome)
+	assert.Equal(t, "owner", event.Context.Get("authz_reason"))
+	require.NoError(t, event.Validate())
+
+	encoded, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.JSONEq(t, untypedEvent, string(encoded))
+}
+
+func TestContext_UnparseableStatusIsKept(t *testing.T) {
+	var reqCtx logsreporting.Context
+	require.NoError(t, json.Unmarshal([]byte(`{"response_status": "n/a"}`), &reqCtx))
+
+	assert.Zero(t, reqCtx.ResponseStatus)
+	assert.Equal(t, "n/a", reqCtx.Get("response_status"))
+}
+
+func TestBuilder_Build(t *testing.T) {
+	at := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	event, err := logsreporting.NewEvent(logsreporting.EventTypeChange, "backend.api").
+		Timestamp(at).
+		Actor(logsreporting.Actor{ID: "alice", Type: "user"}).
+		Action("account.update").
+		Resource(logsreporting.Resource{ID: "42", Type: "account"}).
+		Context(logsreporting.Context{RequestID: "req-1"}).
+		Build()
+	require.NoError(t, err)
+
+	assert.Equal(t, logsreporting.SpecVersion, event.SpecVersion)
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, "event:account:42", event.Subject)
+	assert.Equal(t, at, event.Timestamp)
+}
+
+func TestBuilder_RejectsIncompleteEvent(t *testing.T) {
+	_, err := logsreporting.NewEvent(logsreporting.EventTypeChange, "backend.api").
+		Resource(logsreporting.Resource{ID: "42"}).
+		Build()
+
+	assert.ErrorIs(t, err, logsreporting.ErrInvalidEvent)
+	assert.ErrorContains(t, err, "action, actor.type, resource.type")
+}
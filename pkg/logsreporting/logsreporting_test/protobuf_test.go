@@ -0,0 +1,117 @@
+package logsreporting_test
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// events covering the shapes produced: changes, access, security and bare events
+func protobufEvents(t *testing.T) map[string]*logsreporting.AuditLog {
+	withChanges := sampleEvent(t)
+	withChanges.Resource.Attributes = map[string]any{
+		"name":     "Ada",
+		"age":      36,
+		"admin":    true,
+		"contacts": []any{map[string]any{"phone": "+33612345678"}},
+		"manager":  nil,
+	}
+	withChanges.Changes = []logsreporting.Change{
+		{Field: "email", Old: nil, New: "ada@example.com"},
+		{Field: "version", Old: 1, New: 2},
+		{Field: "roles", Old: []string{"user"}, New: []string{"user", "admin"}},
+		{Field: "updated_at", Old: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), New: nil},
+	}
+
+	access, err := logsreporting.NewEvent(logsreporting.EventTypeAccess, "backend.api").
+		Actor(logsreporting.Actor{Type: logsreporting.ActorAnonymous}).
+		Action("account.read").
+		Resource(logsreporting.Resource{ID: "42", Type: "account"}).
+		Context(logsreporting.Context{RequestID: "req-2", Extra: map[string]string{"access_count": "3"}}).
+		Build()
+	require.NoError(t, err)
+
+	security, err := logsreporting.NewEvent(logsreporting.EventTypeAccessDenied, "backend.api").
+		Actor(logsreporting.Actor{ID: "bob", Type: "user", Tenant: "acme", IP: "203.0.113.7", UserAgent: "curl/8.0"}).
+		Action(logsreporting.EventTypeAccessDenied).
+		Resource(logsreporting.Resource{ID: "/accounts/42", Type: "http_request"}).
+		Context(logsreporting.Context{Method: "DELETE", ResponseStatus: 403, Extra: map[string]string{"reason": "access_denied", "detail": ""}}).
+		Build()
+	require.NoError(t, err)
+
+	return map[string]*logsreporting.AuditLog{
+		"change":   withChanges,
+		"access":   access,
+		"security": security,
+		"empty":    {},
+	}
+}
+
+// viaJSON is what a consumer reads from the JSON wire format.
+func viaJSON(t *testing.T, event *logsreporting.AuditLog) *logsreporting.AuditLog {
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	var decoded logsreporting.AuditLog
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	return &decoded
+}
+
+func TestProtobuf_RoundTripMatchesJSON(t *testing.T) {
+	for name, event := range protobufEvents(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := logsreporting.MarshalProtobuf(event)
+			require.NoError(t, err)
+			decoded, err := logsreporting.UnmarshalProtobuf(data)
+			require.NoError(t, err)
+
+			assert.Equal(t, viaJSON(t, event), decoded)
+		})
+	}
+}
+
+func TestProtobuf_IsSmallerThanJSON(t *testing.T) {
+	event := protobufEvents(t)["change"]
+	pb, err := logsreporting.MarshalProtobuf(event)
+	require.NoError(t, err)
+	js, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	assert.Less(t, len(pb), len(js))
+}
+
+func TestMessage_ProtobufNegotiation(t *testing.T) {
+	for _, mode := range []string{logsreporting.ContentModeBinary, logsreporting.ContentModeLegacy} {
+		t.Run(mode, func(t *testing.T) {
+			event := protobufEvents(t)["change"]
+			msg, err := logsreporting.EncodeMessage("audit_logs", event, logsreporting.Encoding{ContentMode: mode, Format: logsreporting.FormatProtobuf})
+			require.NoError(t, err)
+			assert.Equal(t, "application/protobuf; proto=audit.v1.AuditLog", msg.Header.Get("Content-Type"))
+
+			decoded, err := logsreporting.DecodeMessage(msg)
+			require.NoError(t, err)
+			assert.Equal(t, viaJSON(t, event), decoded)
+		})
+	}
+}
+
+func TestDecodeMessage_WithoutContentTypeIsJSON(t *testing.T) {
+	event := sampleEvent(t)
+	msg := nats.NewMsg("audit_logs")
+	msg.Data, _ = json.Marshal(event)
+
+	decoded, err := logsreporting.DecodeMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, viaJSON(t, event), decoded)
+}
+
+func TestDecodeMessage_RejectsUnknownProtobufSchema(t *testing.T) {
+	msg := nats.NewMsg("audit_logs")
+	msg.Header.Set("Content-Type", "application/protobuf; proto=audit.v2.AuditLog")
+
+	_, err := logsreporting.DecodeMessage(msg)
+	assert.ErrorIs(t, err, logsreporting.ErrInvalidEvent)
+}
@@ -0,0 +1,180 @@
+package logsreporting_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/spool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeProducer struct {
+	mu        sync.Mutex
+	published []string
+	fail      bool
+	attempts  int
+}
+
+func (f *fakeProducer) PublishSync(_ context.Context, event *logsreporting.AuditLog) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.fail {
+		return errors.New("broker unavailable")
+	}
+	f.published = append(f.published, event.ID)
+	return nil
+}
+
+func (f *fakeProducer) ids() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.published...)
+}
+
+func (f *fakeProducer) attempted() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts
+}
+
+func (f *fakeProducer) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func TestQueue_PublishesThroughWorkers(t *testing.T) {
+	producer := &fakeProducer{}
+	queue, err := logsreporting.NewQueue(producer, logsreporting.QueueConfig{Size: 10, Workers: 2, Overflow: logsreporting.OverflowBlock})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, queue.Publish(ctx, &logsreporting.AuditLog{ID: id}))
+	}
+	assert.Eventually(t, func() bool { return len(producer.ids()) == 3 }, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, producer.ids())
+}
+
+func TestQueue_DropOldest(t *testing.T) {
+	producer := &fakeProducer{}
+	queue, err := logsreporting.NewQueue(producer, logsreporting.QueueConfig{Size: 2, Workers: 1, Overflow: logsreporting.OverflowDropOldest})
+	require.NoError(t, err)
+
+	// workers are not running, so the queue fills up
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, queue.Publish(context.Background(), &logsreporting.AuditLog{ID: id}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+	assert.Eventually(t, func() bool { return len(producer.ids()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"2", "3"}, producer.ids())
+}
+
+func TestQueue_BlockGivesUpWithContext(t *testing.T) {
+	queue, err := logsreporting.NewQueue(&fakeProducer{}, logsreporting.QueueConfig{Size: 1, Workers: 1, Overflow: logsreporting.OverflowBlock})
+	require.NoError(t, err)
+	require.NoError(t, queue.Publish(context.Background(), &logsreporting.AuditLog{ID: "1"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, queue.Publish(ctx, &logsreporting.AuditLog{ID: "2"}), context.DeadlineExceeded)
+}
+
+// hangingProducer never hears back from the broker about the event "hang".
+type hangingProducer struct {
+	fakeProducer
+}
+
+func (h *hangingProducer) PublishSync(ctx context.Context, event *logsreporting.AuditLog) error {
+	if event.ID == "hang" {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return h.fakeProducer.PublishSync(ctx, event)
+}
+
+func TestQueue_WorkersGiveUpAfterPublishTimeout(t *testing.T) {
+	producer := &hangingProducer{}
+	queue, err := logsreporting.NewQueue(producer, logsreporting.QueueConfig{Size: 10, Workers: 1, Overflow: logsreporting.OverflowDropOldest, PublishTimeout: 20 * time.Millisecond})
+	require.NoError(t, err)
+	for _, id := range []string{"hang", "1"} {
+		require.NoError(t, queue.Publish(context.Background(), &logsreporting.AuditLog{ID: id}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+	assert.Eventually(t, func() bool { return len(producer.ids()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1"}, producer.ids())
+}
+
+func openSpool(t *testing.T, dir string) *spool.WAL {
+	wal, err := spool.Open(dir, spool.Options{Sync: spool.SyncNone})
+	require.NoError(t, err)
+	return wal
+}
+
+func TestQueue_SpillsAndReplays(t *testing.T) {
+	producer := &fakeProducer{fail: true}
+	wal := openSpool(t, t.TempDir())
+	defer wal.Close()
+	queue, err := logsreporting.NewQueue(producer, logsreporting.QueueConfig{Size: 1, Workers: 1, Overflow: logsreporting.OverflowSpill, Spool: wal})
+	require.NoError(t, err)
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, queue.Publish(context.Background(), &logsreporting.AuditLog{ID: id}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	// failed publications stay in the spool, and are replayed once the broker is back
+	require.Eventually(t, func() bool { return producer.attempted() > 0 }, 5*time.Second, 5*time.Millisecond)
+	producer.setFail(false)
+	queue.Replay()
+	assert.Eventually(t, func() bool { return len(producer.ids()) >= 3 }, 5*time.Second, 20*time.Millisecond)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, producer.ids())
+}
+
+func TestQueue_ReplaysSpoolOnStartup(t *testing.T) {
+	dir := t.TempDir()
+	wal := openSpool(t, dir)
+	stopped, err := logsreporting.NewQueue(&fakeProducer{}, logsreporting.QueueConfig{Size: 10, Workers: 1, Overflow: logsreporting.OverflowBlock, Spool: wal})
+	require.NoError(t, err)
+	// the service stops before the events are published
+	for _, id := range []string{"1", "2"} {
+		require.NoError(t, stopped.Publish(context.Background(), &logsreporting.AuditLog{ID: id}))
+	}
+	require.NoError(t, wal.Close())
+
+	producer := &fakeProducer{}
+	wal = openSpool(t, dir)
+	defer wal.Close()
+	queue, err := logsreporting.NewQueue(producer, logsreporting.QueueConfig{Size: 10, Workers: 1, Overflow: logsreporting.OverflowBlock, Spool: wal})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	assert.Eventually(t, func() bool { return len(producer.ids()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1", "2"}, producer.ids())
+}
+
+func TestNewQueue_Rejects(t *testing.T) {
+	_, err := logsreporting.NewQueue(&fakeProducer{}, logsreporting.QueueConfig{Size: 1, Workers: 1, Overflow: "explode"})
+	assert.Error(t, err)
+	_, err = logsreporting.NewQueue(&fakeProducer{}, logsreporting.QueueConfig{Size: 1, Workers: 1, Overflow: logsreporting.OverflowSpill})
+	assert.Error(t, err, "spill without a spool")
+}
@@ -0,0 +1,68 @@
+package logsreporting_test
+
+import (
+	"encoding/json"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func decodeResource(t *testing.T, resource string) logsreporting.Resource {
+	var decoded logsreporting.Resource
+	require.NoError(t, json.Unmarshal([]byte(resource), &decoded))
+	return decoded
+}
+
+func TestResource_Upgrade(t *testing.T) {
+	tests := map[string]struct {
+		resource string
+		upgraded bool
+		expected string
+	}{
+		"legacy": {
+			resource: `{"id":"42","type":"account","attributes":{"id":"42","type":"account","attributes":"{\"name\":\"Ada\",\"tags\":[\"a\"]}"}}`,
+			upgraded: true,
+			expected: `{"id":"42","type":"account","attributes":{"name":"Ada","tags":["a"]}}`,
+		},
+		"legacy without body": {
+			resource: `{"id":"42","type":"account","attributes":{"id":"42","type":"account","attributes":""}}`,
+			upgraded: true,
+			expected: `{"id":"42","type":"account"}`,
+		},
+		"legacy with unparseable body": {
+			resource: `{"id":"42","type":"account","attributes":{"id":"42","type":"account","attributes":"name=Ada"}}`,
+			upgraded: true,
+			expected: `{"id":"42","type":"account","attributes":"name=Ada"}`,
+		},
+		"structured": {
+			resource: `{"id":"42","type":"account","attributes":{"name":"Ada"}}`,
+			expected: `{"id":"42","type":"account","attributes":{"name":"Ada"}}`,
+		},
+		"structured holding an attributes string": {
+			resource: `{"id":"42","type":"account","attributes":{"id":"7","type":"account","attributes":"{}"}}`,
+			expected: `{"id":"42","type":"account","attributes":{"id":"7","type":"account","attributes":"{}"}}`,
+		},
+		"access": {
+			resource: `{"id":"42","type":"account"}`,
+			expected: `{"id":"42","type":"account"}`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resource := decodeResource(t, tt.resource)
+			assert.Equal(t, tt.upgraded, resource.Upgrade())
+			assert.Equal(t, decodeResource(t, tt.expected), resource)
+		})
+	}
+}
+
+func TestResource_UpgradeInProcessLegacy(t *testing.T) {
+	resource := logsreporting.Resource{
+		ID:         "42",
+		Type:       "account",
+		Attributes: map[string]string{"id": "42", "type": "account", "attributes": `{"name":"Ada"}`},
+	}
+	require.True(t, resource.Upgrade())
+	assert.Equal(t, logsreporting.Resource{ID: "42", Type: "account", Attributes: map[string]any{"name": "Ada"}}, resource)
+}
@@ -0,0 +1,98 @@
+package logsreporting_test
+
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateSchema_AcceptsBuiltEvents(t *testing.T) {
+	for name, event := range protobufEvents(t) {
+		if name == "empty" {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, logsreporting.ValidateSchema(event))
+		})
+	}
+}
+
+func TestValidateSchema_AcceptsLegacyResource(t *testing.T) {
+	event := sampleEvent(t)
+	event.SpecVersion = "1.0"
+	event.Resource.Attributes = map[string]any{"id": "42", "type": "account", "attributes": `{"name":"Ada"}`}
+
+	assert.NoError(t, logsreporting.ValidateSchema(event))
+}
+
+// baselineEvents are events as published by the first producer, before the
+// events were typed: the actor only has an id, and the resource the legacy shape.
+var baselineEvents = map[string]string{
+	"update": `{"spec_version":"1.0","id":"3b2d6c1e-8f4a-4c57-9a43-6f0e2d1b7c90","source":"backend.api","type":"audit.event",` +
+		`"subject":"event:account:42","timestamp":"2025-01-01T10:00:00.123456Z","actor":{"id":"9d2f4b7a-1c3e-4f5a-8b6d-0e7c9a1f2b3d"},` +
+		`"action":"PATCH","resource":{"attributes":{"attributes":"{\"name\":\"Ada\"}","id":"42","type":"account"},"id":"42","type":"account"},` +
+		`"metadata":{"protocol":"HTTP/1.1","request_id":"host/abcdef-000001","response_status":"200"}}`,
+	"create": `{"spec_version":"1.0","id":"0a6e4f8c-2b1d-4e3f-9c5a-7d8b6e4f2a1c","source":"backend.api","type":"audit.event",` +
+		`"subject":"event:account:","timestamp":"2025-01-01T10:00:00.123456Z","actor":{"id":"1f3e5d7c-9b2a-4c6e-8d0f-2a4c6e8b0d1f"},` +
+		`"action":"POST","resource":{"attributes":{"attributes":"{\"name\":\"Ada\",\"email\":\"ada@example.com\"}","id":"","type":"account"},"id":"","type":"account"},` +
+		`"metadata":{"protocol":"HTTP/1.1","request_id":"host/abcdef-000002","response_status":"201"}}`,
+	"without body": `{"spec_version":"1.0","id":"7c9e1a3b-5d7f-4b9d-8e1f-3a5c7e9b1d3f","source":"backend.api","type":"audit.event",` +
+		`"subject":"event:account:42","timestamp":"2025-01-01T10:00:00.123456Z","actor":{"id":"9d2f4b7a-1c3e-4f5a-8b6d-0e7c9a1f2b3d"},` +
+		`"action":"DELETE","resource":{"attributes":{"attributes":"","id":"42","type":"account"},"id":"42","type":"account"},` +
+		`"metadata":{"protocol":"HTTP/1.1","request_id":"host/abcdef-000003","response_status":"204"}}`,
+}
+
+func TestValidateSchema_AcceptsBaselineEvents(t *testing.T) {
+	for name, data := range baselineEvents {
+		t.Run(name, func(t *testing.T) {
+			msg := nats.NewMsg(logsreporting.LegacySubject)
+			msg.Data = []byte(data)
+			event, err := logsreporting.DecodeMessage(msg)
+			require.NoError(t, err)
+			assert.NoError(t, logsreporting.ValidateSchema(event))
+
+			upcast, err := logsreporting.UpcastEvent(event)
+			require.NoError(t, err)
+			assert.NoError(t, logsreporting.ValidateSchema(upcast))
+		})
+	}
+}
+
+func TestValidateSchema_ReportsEveryError(t *testing.T) {
+	event := sampleEvent(t)
+	event.ID = "42"
+	event.Source = ""
+	event.Action = ""
+	event.Timestamp = time.Time{}
+	event.Actor = logsreporting.Actor{ID: "alice"}
+	event.Changes = append(event.Changes, logsreporting.Change{})
+
+	err := logsreporting.ValidateSchema(event)
+	require.ErrorIs(t, err, logsreporting.ErrInvalidEvent)
+	var schemaErr *logsreporting.SchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, logsreporting.SpecVersion, schemaErr.SpecVersion)
+	for _, location := range []string{"/id", "/source", "/action", "/timestamp", "/actor", "/changes/1/field"} {
+		assert.Condition(t, func() bool {
+			for _, e := range schemaErr.Errors {
+				if strings.HasPrefix(e, location+":") {
+					return true
+				}
+			}
+			return false
+		}, "no error at %s in %v", location, schemaErr.Errors)
+	}
+}
+
+func TestValidateSchema_RejectsUnknownSpecVersion(t *testing.T) {
+	event := sampleEvent(t)
+	event.SpecVersion = "0.9"
+
+	var schemaErr *logsreporting.SchemaError
+	require.ErrorAs(t, logsreporting.ValidateSchema(event), &schemaErr)
+	assert.Equal(t, []string{`/spec_version: unsupported spec_version "0.9"`}, schemaErr.Errors)
+}
@@ -0,0 +1,63 @@
+package logsreporting_test
+
+import (
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSubjectTemplate_Subject(t *testing.T) {
+	subjects := logsreporting.MustParseSubjectTemplate(logsreporting.DefaultSubjectTemplate)
+	tests := map[string]struct {
+		event *logsreporting.AuditLog
+		want  string
+	}{
+		"change": {
+			event: &logsreporting.AuditLog{Actor: logsreporting.Actor{Type: "api_key", Tenant: "acme"}, Action: "account.update", Resource: logsreporting.Resource{Type: "account"}},
+			want:  "audit.acme.account.account.update",
+		},
+		"security": {
+			event: &logsreporting.AuditLog{Actor: logsreporting.Actor{Type: logsreporting.ActorAnonymous}, Action: logsreporting.EventTypeAccessDenied, Resource: logsreporting.Resource{Type: "http_request"}},
+			want:  "audit._.http_request.security.access_denied",
+		},
+		"sanitized": {
+			event: &logsreporting.AuditLog{Actor: logsreporting.Actor{Tenant: "acme.eu *"}, Action: "account..delete>", Resource: logsreporting.Resource{Type: "account"}},
+			want:  "audit.acme_eu__.account.account._.delete_",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tt.want, subjects.Subject(tt.event))
+		})
+	}
+}
+
+func TestSubjectTemplate_Wildcard(t *testing.T) {
+	for template, want := range map[string]string{
+		logsreporting.DefaultSubjectTemplate:       "audit.*.*.>",
+		"events.{source}.{type}":                   "events.*.*",
+		"audit.{actor_type}.fixed.{resource_type}": "audit.*.fixed.*",
+		logsreporting.LegacySubject:                "audit_logs",
+	} {
+		subjects, err := logsreporting.ParseSubjectTemplate(template)
+		require.NoError(t, err, template)
+		assert.Equal(t, want, subjects.Wildcard(), template)
+		assert.Equal(t, template, subjects.String())
+	}
+}
+
+func TestParseSubjectTemplate_Rejects(t *testing.T) {
+	for _, template := range []string{
+		"",
+		"audit..{action}",
+		"audit.{action}.{tenant}",
+		"audit.{unknown}",
+		"audit.*.{action}",
+		"audit.>",
+		"audit.x{tenant}",
+	} {
+		_, err := logsreporting.ParseSubjectTemplate(template)
+		assert.Error(t, err, template)
+	}
+}
@@ -0,0 +1,95 @@
+package logsreporting_test
+
+import (
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// an event of spec_version 1.0 whose resource has the legacy shape
+const legacyEvent = `{
+  "spec_version": "1.0",
+  "id": "5f0c1d2e-0000-4000-8000-000000000002",
+  "source": "backend.api",
+  "type": "audit.event",
+  "subject": "event:account:42",
+  "timestamp": "2025-01-01T10:00:00Z",
+  "actor": {"id": "alice", "type": "user"},
+  "action": "account.update",
+  "resource": {"id": "42", "type": "account", "attributes": {"id": "42", "type": "account", "attributes": "{\"name\":\"Ada\"}"}},
+  "metadata": {"request_id": "req-1"}
+}`
+
+func TestUpcast_FromBaselineProducer(t *testing.T) {
+	event, err := logsreporting.Upcast([]byte(baselineEvents["update"]))
+	require.NoError(t, err)
+	assert.Equal(t, logsreporting.Actor{ID: "9d2f4b7a-1c3e-4f5a-8b6d-0e7c9a1f2b3d", Type: "user"}, event.Actor)
+	assert.Equal(t, logsreporting.Resource{ID: "42", Type: "account", Attributes: map[string]any{"name": "Ada"}}, event.Resource)
+	assert.NoError(t, logsreporting.ValidateSchema(event))
+}
+
+func TestUpcast_FromFirstVersion(t *testing.T) {
+	event, err := logsreporting.Upcast([]byte(legacyEvent))
+	require.NoError(t, err)
+
+	assert.Equal(t, logsreporting.SpecVersion, event.SpecVersion)
+	assert.Equal(t, logsreporting.Resource{ID: "42", Type: "account", Attributes: map[string]any{"name": "Ada"}}, event.Resource)
+	assert.Equal(t, logsreporting.Actor{ID: "alice", Type: "user"}, event.Actor)
+	assert.Equal(t, "req-1", event.Context.RequestID)
+	assert.NoError(t, logsreporting.ValidateSchema(event))
+}
+
+func TestUpcast_CurrentVersionIsUnchanged(t *testing.T) {
+	event := sampleEvent(t)
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	upcast, err := logsreporting.Upcast(data)
+	require.NoError(t, err)
+	assert.Equal(t, viaJSON(t, event), upcast)
+
+	same, err := logsreporting.UpcastEvent(event)
+	require.NoError(t, err)
+	assert.Same(t, event, same)
+}
+
+func TestUpcast_RejectsUnknownVersion(t *testing.T) {
+	_, err := logsreporting.Upcast([]byte(`{"spec_version": "9.0"}`))
+	assert.ErrorIs(t, err, logsreporting.ErrInvalidEvent)
+}
+
+func TestMessage_CarriesSpecVersionAsDataSchema(t *testing.T) {
+	var legacy logsreporting.AuditLog
+	require.NoError(t, json.Unmarshal([]byte(legacyEvent), &legacy))
+
+	for _, event := range []*logsreporting.AuditLog{sampleEvent(t), &legacy} {
+		for _, mode := range []string{logsreporting.ContentModeStructured, logsreporting.ContentModeBinary} {
+			msg, err := logsreporting.EncodeMessage("audit_logs", event, logsreporting.Encoding{ContentMode: mode})
+			require.NoError(t, err)
+
+			decoded, err := logsreporting.DecodeMessage(msg)
+			require.NoError(t, err)
+			assert.Equal(t, event.SpecVersion, decoded.SpecVersion, mode)
+		}
+	}
+}
+
+func TestDecodeMessage_WithoutDataSchemaIsFirstVersion(t *testing.T) {
+	msg := nats.NewMsg("audit_logs")
+	msg.Data = []byte(`{"specversion":"1.0","id":"e1","source":"/s","type":"t"}`)
+
+	event, err := logsreporting.DecodeMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", event.SpecVersion)
+}
+
+func TestDecodeMessage_RejectsUnknownDataSchema(t *testing.T) {
+	msg := nats.NewMsg("audit_logs")
+	msg.Data = []byte(`{"specversion":"1.0","id":"e1","source":"/s","type":"t","dataschema":"https://example.com/audit_log.9.0.json"}`)
+
+	_, err := logsreporting.DecodeMessage(msg)
+	assert.ErrorIs(t, err, logsreporting.ErrInvalidEvent)
+}
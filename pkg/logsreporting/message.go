@@ -4,15 +4,39 @@ import (
 	"time"
 )
 
+// Event types
+const (
+	// EventTypeChange records an operation performed on a resource.
+	EventTypeChange = "audit.event"
+	// EventTypeAccess records that a resource was read, with a lighter payload.
+	EventTypeAccess = "audit.access"
+)
+
+// ActorAnonymous is the type of the actor of an unauthenticated request.
+const ActorAnonymous = "anonymous"
+
+// AuditLog is an audit event. Its JSON is the wire format shared by the
+// producers and the audit log service; build one with NewEvent.
 type AuditLog struct {
-	SpecVersion string            `json:"spec_version"`
-	ID          string            `json:"id"`
-	Source      string            `json:"source"`
-	Type        string            `json:"type"`
-	Subject     string            `json:"subject"`
-	Timestamp   time.Time         `json:"timestamp"`
-	Actor       map[string]string `json:"actor"`
-	Action      string            `json:"action"`
-	Resource    map[string]any    `json:"resource"`
-	Metadata    map[string]string `json:"metadata"`
+	SpecVersion string    `json:"spec_version"`
+	ID          string    `json:"id"`
+	Source      string    `json:"source"`
+	Type        string    `json:"type"`
+	Subject     string    `json:"subject"`
+	Timestamp   time.Time `json:"timestamp"`
+	Actor       Actor     `json:"actor"`
+	Action      string    `json:"action"`
+	Resource    Resource  `json:"resource"`
+	// Context describes the request the event originates from. It is
+	// serialized under "metadata" along with the free-form entries.
+	Context Context  `json:"metadata"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Change is the field-level diff of a mutated resource. Old is null for a
+// created resource and New is null for a deleted one.
+type Change struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
 }
@@ -2,8 +2,17 @@ package logsreporting
 
 import (
 	"context"
+	"errors"
 )
 
+// ErrAuditUnavailable is returned when an event cannot be durably recorded.
+var ErrAuditUnavailable = errors.New("audit persistence unavailable")
+
 type Producer interface {
 	Publish(ctx context.Context, audiLogMsg *AuditLog) error
 }
+
+// SyncProducer publishes an event and only returns once the broker has received it.
+type SyncProducer interface {
+	PublishSync(ctx context.Context, auditLogMsg *AuditLog) error
+}
@@ -2,7 +2,7 @@ package logsreporting
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 	"time"
@@ -10,18 +10,27 @@ import (
 
 type LogsReporting struct {
 	natsConn *nats.Conn
+	encoding Encoding
+	subjects SubjectTemplate
 }
 
-func NewProducer(natsConn *nats.Conn) *LogsReporting {
+// NewProducer publishes events laid out according to encoding, each on the
+// subject subjects builds from it.
+func NewProducer(natsConn *nats.Conn, encoding Encoding, subjects SubjectTemplate) (*LogsReporting, error) {
+	if err := encoding.validate(); err != nil {
+		return nil, err
+	}
 	return &LogsReporting{
 		natsConn: natsConn,
-	}
+		encoding: encoding,
+		subjects: subjects,
+	}, nil
 }
 
 func (l *LogsReporting) Publish(mainCtx context.Context, auditLogMsg *AuditLog) error {
 	log.Debug().Msg("publishing audit logs...")
 
-	data, err := json.Marshal(auditLogMsg)
+	msg, err := EncodeMessage(l.subjects.Subject(auditLogMsg), auditLogMsg, l.encoding)
 	if err != nil {
 		log.Err(err).Msg("error marshalling audit log")
 		return err
@@ -45,7 +54,7 @@ func (l *LogsReporting) Publish(mainCtx context.Context, auditLogMsg *AuditLog)
 			log.Info().Msg("NATS reconnected, resuming publish")
 		}
 
-		err = l.natsConn.Publish("audit_logs", data)
+		err = l.natsConn.PublishMsg(msg)
 		if err == nil {
 			log.Info().Msg("audit log successfully published")
 			return nil
@@ -65,3 +74,22 @@ func (l *LogsReporting) Publish(mainCtx context.Context, auditLogMsg *AuditLog)
 	log.Error().Msg("failed to publish audit log after multiple attempts")
 	return err
 }
+
+// PublishSync publishes the event without retrying and waits for the server to
+// acknowledge it, so the caller knows whether it was received.
+func (l *LogsReporting) PublishSync(ctx context.Context, auditLogMsg *AuditLog) error {
+	msg, err := EncodeMessage(l.subjects.Subject(auditLogMsg), auditLogMsg, l.encoding)
+	if err != nil {
+		return err
+	}
+	if !l.natsConn.IsConnected() {
+		return ErrAuditUnavailable
+	}
+	if err := l.natsConn.PublishMsg(msg); err != nil {
+		return fmt.Errorf("%w: %v", ErrAuditUnavailable, err)
+	}
+	if err := l.natsConn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrAuditUnavailable, err)
+	}
+	return nil
+}
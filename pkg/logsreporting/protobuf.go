@@ -0,0 +1,152 @@
+package logsreporting
+
+import (
+	"encoding/json"
+	"github.com/ramk42/omi-backend-assignment/pkg/auditpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Wire formats, how an event is serialized.
+const (
+	// FormatJSON serializes the event as JSON.
+	FormatJSON = "json"
+	// FormatProtobuf serializes the event as an audit.v1.AuditLog protobuf message.
+	FormatProtobuf = "protobuf"
+)
+
+// contentTypeProtobuf is the content type of the protobuf wire format, naming the schema version.
+const contentTypeProtobuf = "application/protobuf; proto=audit.v1.AuditLog"
+
+// MarshalProtobuf serializes the event in the protobuf wire format.
+func MarshalProtobuf(event *AuditLog) ([]byte, error) {
+	pb := &auditpb.AuditLog{
+		SpecVersion: event.SpecVersion,
+		Id:          event.ID,
+		Source:      event.Source,
+		Type:        event.Type,
+		Subject:     event.Subject,
+		Actor: &auditpb.Actor{
+			Type:      event.Actor.Type,
+			Id:        event.Actor.ID,
+			Display:   event.Actor.Display,
+			Tenant:    event.Actor.Tenant,
+			Ip:        event.Actor.IP,
+			UserAgent: event.Actor.UserAgent,
+			Extra:     event.Actor.Extra,
+		},
+		Action: event.Action,
+		Resource: &auditpb.Resource{
+			Id:   event.Resource.ID,
+			Type: event.Resource.Type,
+		},
+		Context: &auditpb.Context{
+			RequestId:      event.Context.RequestID,
+			Ip:             event.Context.IP,
+			UserAgent:      event.Context.UserAgent,
+			Method:         event.Context.Method,
+			Protocol:       event.Context.Protocol,
+			ResponseStatus: int32(event.Context.ResponseStatus),
+			Outcome:        event.Context.Outcome,
+			Extra:          event.Context.Extra,
+		},
+	}
+	if !event.Timestamp.IsZero() {
+		pb.Timestamp = timestamppb.New(event.Timestamp)
+	}
+	var err error
+	if event.Resource.Attributes != nil {
+		if pb.Resource.Attributes, err = toValue(event.Resource.Attributes); err != nil {
+			return nil, err
+		}
+	}
+	for _, change := range event.Changes {
+		pbChange := &auditpb.Change{Field: change.Field}
+		if pbChange.Old, err = toValue(change.Old); err != nil {
+			return nil, err
+		}
+		if pbChange.New, err = toValue(change.New); err != nil {
+			return nil, err
+		}
+		pb.Changes = append(pb.Changes, pbChange)
+	}
+	return proto.Marshal(pb)
+}
+
+// UnmarshalProtobuf reads an event serialized in the protobuf wire format.
+func UnmarshalProtobuf(data []byte) (*AuditLog, error) {
+	var pb auditpb.AuditLog
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return nil, err
+	}
+	event := &AuditLog{
+		SpecVersion: pb.GetSpecVersion(),
+		ID:          pb.GetId(),
+		Source:      pb.GetSource(),
+		Type:        pb.GetType(),
+		Subject:     pb.GetSubject(),
+		Actor: Actor{
+			Type:      pb.GetActor().GetType(),
+			ID:        pb.GetActor().GetId(),
+			Display:   pb.GetActor().GetDisplay(),
+			Tenant:    pb.GetActor().GetTenant(),
+			IP:        pb.GetActor().GetIp(),
+			UserAgent: pb.GetActor().GetUserAgent(),
+			Extra:     pb.GetActor().GetExtra(),
+		},
+		Action: pb.GetAction(),
+		Resource: Resource{
+			ID:         pb.GetResource().GetId(),
+			Type:       pb.GetResource().GetType(),
+			Attributes: fromValue(pb.GetResource().GetAttributes()),
+		},
+		Context: Context{
+			RequestID:      pb.GetContext().GetRequestId(),
+			IP:             pb.GetContext().GetIp(),
+			UserAgent:      pb.GetContext().GetUserAgent(),
+			Method:         pb.GetContext().GetMethod(),
+			Protocol:       pb.GetContext().GetProtocol(),
+			ResponseStatus: int(pb.GetContext().GetResponseStatus()),
+			Outcome:        pb.GetContext().GetOutcome(),
+			Extra:          pb.GetContext().GetExtra(),
+		},
+	}
+	if pb.GetTimestamp() != nil {
+		event.Timestamp = pb.GetTimestamp().AsTime()
+	}
+	for _, change := range pb.GetChanges() {
+		event.Changes = append(event.Changes, Change{
+			Field: change.GetField(),
+			Old:   fromValue(change.GetOld()),
+			New:   fromValue(change.GetNew()),
+		})
+	}
+	return event, nil
+}
+
+// toValue converts a JSON-like value. Values structpb does not know, such as
+// structs or times, are converted through their JSON encoding so that both
+// wire formats carry the same document.
+func toValue(v any) (*structpb.Value, error) {
+	if value, err := structpb.NewValue(v); err == nil {
+		return value, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(doc)
+}
+
+// fromValue converts back to the value json.Unmarshal would give, nil when unset.
+func fromValue(value *structpb.Value) any {
+	if value == nil {
+		return nil
+	}
+	return value.AsInterface()
+}
@@ -0,0 +1,318 @@
+package logsreporting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/ramk42/omi-backend-assignment/pkg/spool"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// Overflow policies, applied when an event is published while the queue is full.
+const (
+	// OverflowBlock waits for room in the queue, pushing back on the caller.
+	OverflowBlock = "block"
+	// OverflowDropOldest evicts the oldest queued event to make room.
+	OverflowDropOldest = "drop-oldest"
+	// OverflowSpill leaves the event in the spool, it is replayed once the queue has room again.
+	OverflowSpill = "spill"
+)
+
+const (
+	spoolReplayInterval   = time.Second
+	defaultPublishTimeout = 5 * time.Second
+)
+
+// queueMetrics is published on /debug/vars.
+var queueMetrics = expvar.NewMap("audit_publish_queue")
+
+// QueueConfig sizes a Queue.
+type QueueConfig struct {
+	Size     int
+	Workers  int
+	Overflow string
+	// Spool, when set, durably records every event before it is queued.
+	Spool *spool.WAL
+	// PublishTimeout bounds how long a worker waits for the broker to receive
+	// an event, 5 seconds when zero.
+	PublishTimeout time.Duration
+}
+
+// queued is an event along with its sequence number in the spool, 0 when there is none.
+type queued struct {
+	seq   uint64
+	event *AuditLog
+}
+
+// Queue is a Producer that hands events over to a fixed pool of workers
+// publishing them with the wrapped producer, so that callers are not held by a
+// slow or disconnected broker and the number of pending events is bounded.
+//
+// Workers make a single attempt per event, bounded by the publish timeout, so
+// that an outage does not hold them. With a spool, an event is written to disk
+// before it is queued and acknowledged once published: events that could not
+// be published, or were still queued when the service stopped, are replayed in
+// order on startup, after a reconnection and periodically. Without one, an
+// event that fails to be published is lost.
+type Queue struct {
+	producer       SyncProducer
+	events         chan queued
+	workers        int
+	overflow       string
+	spool          *spool.WAL
+	replay         chan struct{}
+	publishTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight map[uint64]struct{} // spooled events currently queued or being published
+}
+
+func NewQueue(producer SyncProducer, cfg QueueConfig) (*Queue, error) {
+	if cfg.Size <= 0 || cfg.Workers <= 0 {
+		return nil, errors.New("queue size and workers must be positive")
+	}
+	switch cfg.Overflow {
+	case OverflowBlock, OverflowDropOldest:
+	case OverflowSpill:
+		if cfg.Spool == nil {
+			return nil, errors.New("the spill overflow policy requires a spool")
+		}
+	default:
+		return nil, fmt.Errorf("unknown overflow policy %q", cfg.Overflow)
+	}
+	if cfg.PublishTimeout <= 0 {
+		cfg.PublishTimeout = defaultPublishTimeout
+	}
+	q := &Queue{
+		producer:       producer,
+		events:         make(chan queued, cfg.Size),
+		workers:        cfg.Workers,
+		overflow:       cfg.Overflow,
+		spool:          cfg.Spool,
+		replay:         make(chan struct{}, 1),
+		inFlight:       map[uint64]struct{}{},
+		publishTimeout: cfg.PublishTimeout,
+	}
+	queueMetrics.Set("depth", expvar.Func(func() any { return len(q.events) }))
+	queueMetrics.Set("capacity", expvar.Func(func() any { return cap(q.events) }))
+	if q.spool != nil {
+		queueMetrics.Set("spool_lost", expvar.Func(func() any { return q.spool.Lost() }))
+	}
+	return q, nil
+}
+
+// Publish spools and enqueues the event. It only blocks with the block overflow policy.
+func (q *Queue) Publish(ctx context.Context, event *AuditLog) error {
+	item := queued{event: event}
+	if q.spool != nil {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		// tracked under the same lock so that the replay cannot pick the event up in between
+		q.mu.Lock()
+		item.seq, err = q.spool.Append(data)
+		if err == nil {
+			q.inFlight[item.seq] = struct{}{}
+		}
+		q.mu.Unlock()
+		if err != nil {
+			queueMetrics.Add("spool_errors", 1)
+			return err
+		}
+	}
+
+	if q.tryEnqueue(item) {
+		return nil
+	}
+	switch q.overflow {
+	case OverflowBlock:
+		select {
+		case q.events <- item:
+			queueMetrics.Add("enqueued", 1)
+			return nil
+		case <-ctx.Done():
+			// a spooled event is replayed later
+			q.untrack(item.seq)
+			if q.spool == nil {
+				queueMetrics.Add("dropped", 1)
+			}
+			return ctx.Err()
+		}
+	case OverflowDropOldest:
+		for !q.tryEnqueue(item) {
+			select {
+			case oldest := <-q.events:
+				q.done(oldest)
+				queueMetrics.Add("dropped", 1)
+				log.Warn().Str("event_id", oldest.event.ID).Msg("audit publish queue full, dropped the oldest event")
+			default:
+			}
+		}
+		return nil
+	default:
+		q.untrack(item.seq)
+		queueMetrics.Add("spilled", 1)
+		return nil
+	}
+}
+
+// Replay asks for the spooled events to be replayed, e.g. once the broker is reachable again.
+func (q *Queue) Replay() {
+	select {
+	case q.replay <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the queued events until ctx is canceled. Events still queued
+// then are lost, unless they are spooled.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range q.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	if q.spool != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.replaySpool(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if q.spool == nil {
+		queueMetrics.Add("dropped", int64(len(q.events)))
+	}
+	log.Info().Int("pending", len(q.events)).Msg("audit publish queue stopped")
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-q.events:
+			if err := q.publish(ctx, item.event); err != nil {
+				log.Error().Err(err).Str("event_id", item.event.ID).Msg("failure to publish audit event")
+				queueMetrics.Add("failed", 1)
+				// left in the spool to be replayed
+				q.untrack(item.seq)
+				continue
+			}
+			queueMetrics.Add("published", 1)
+			q.done(item)
+		}
+	}
+}
+
+func (q *Queue) publish(ctx context.Context, event *AuditLog) error {
+	ctx, cancel := context.WithTimeout(ctx, q.publishTimeout)
+	defer cancel()
+	return q.producer.PublishSync(ctx, event)
+}
+
+// replaySpool queues the spooled events that are neither published nor
+// already queued, in order, as long as the queue has room.
+func (q *Queue) replaySpool(ctx context.Context) {
+	ticker := time.NewTicker(spoolReplayInterval)
+	defer ticker.Stop()
+	for {
+		if err := q.replayPending(); err != nil && !errors.Is(err, spool.ErrClosed) {
+			log.Error().Err(err).Msg("failure to replay the audit spool")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.replay:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) replayPending() error {
+	type record struct {
+		seq     uint64
+		payload []byte
+	}
+	// enough records to fill the queue once those in flight are skipped; they
+	// are filtered afterwards as the queue lock must not be taken within the spool's
+	q.mu.Lock()
+	limit := cap(q.events) - len(q.events) + len(q.inFlight)
+	q.mu.Unlock()
+	var records []record
+	err := q.spool.Pending(func(seq uint64, payload []byte) bool {
+		records = append(records, record{seq: seq, payload: payload})
+		return len(records) < limit
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		q.mu.Lock()
+		_, inFlight := q.inFlight[r.seq]
+		q.inFlight[r.seq] = struct{}{}
+		q.mu.Unlock()
+		if inFlight {
+			continue
+		}
+
+		var event AuditLog
+		if err := json.Unmarshal(r.payload, &event); err != nil {
+			log.Error().Err(err).Uint64("seq", r.seq).Msg("skipping undecodable spooled audit event")
+			q.done(queued{seq: r.seq})
+			continue
+		}
+		if !q.tryEnqueue(queued{seq: r.seq, event: &event}) {
+			q.untrack(r.seq)
+			return nil
+		}
+		queueMetrics.Add("replayed", 1)
+	}
+	return nil
+}
+
+func (q *Queue) tryEnqueue(item queued) bool {
+	select {
+	case q.events <- item:
+		queueMetrics.Add("enqueued", 1)
+		return true
+	default:
+		return false
+	}
+}
+
+// done releases an event that needs no more publishing.
+func (q *Queue) done(item queued) {
+	if item.seq == 0 {
+		return
+	}
+	q.ack(item.seq)
+	q.untrack(item.seq)
+}
+
+func (q *Queue) ack(seq uint64) {
+	if err := q.spool.Ack(seq); err != nil {
+		queueMetrics.Add("spool_errors", 1)
+		log.Error().Err(err).Uint64("seq", seq).Msg("failure to acknowledge spooled audit event")
+	}
+}
+
+func (q *Queue) untrack(seq uint64) {
+	if seq == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inFlight, seq)
+}
@@ -0,0 +1,72 @@
+package logsreporting
+
+import (
+	"encoding/json"
+)
+
+// Resource is what the action was performed on.
+type Resource struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Attributes is the JSON document describing the resource, typically the
+	// request payload. It is nil when unknown.
+	Attributes any `json:"attributes,omitempty"`
+}
+
+// Upgrade rewrites a resource of the legacy shape, whose attributes repeat its
+// id and type along with the request body serialized as a JSON string:
+//
+//	{"id": "42", "type": "account", "attributes": {"id": "42", "type": "account", "attributes": "{\"name\":\"Ada\"}"}}
+//
+// into the structured shape, whose attributes are the body itself:
+//
+//	{"id": "42", "type": "account", "attributes": {"name": "Ada"}}
+//
+// An empty body leaves the resource without attributes, and a body that is not
+// valid JSON is kept as a string. It reports whether the resource was rewritten.
+func (r *Resource) Upgrade() bool {
+	body, ok := r.legacyBody()
+	if !ok {
+		return false
+	}
+	r.Attributes = nil
+	if body == "" {
+		return true
+	}
+	var attributes any
+	if err := json.Unmarshal([]byte(body), &attributes); err != nil {
+		r.Attributes = body
+		return true
+	}
+	r.Attributes = attributes
+	return true
+}
+
+// Legacy reports whether the resource has the legacy shape Upgrade rewrites.
+func (r *Resource) Legacy() bool {
+	_, ok := r.legacyBody()
+	return ok
+}
+
+// legacyBody returns the serialized body of a legacy resource. The nested id
+// and type must match the resource's own, so that structured attributes which
+// happen to hold an "attributes" string are not mistaken for the legacy shape.
+func (r *Resource) legacyBody() (string, bool) {
+	var nested map[string]any
+	switch attributes := r.Attributes.(type) {
+	case map[string]any:
+		nested = attributes
+	case map[string]string:
+		nested = make(map[string]any, len(attributes))
+		for key, value := range attributes {
+			nested[key] = value
+		}
+	default:
+		return "", false
+	}
+	if len(nested) != 3 || nested["id"] != any(r.ID) || nested["type"] != any(r.Type) {
+		return "", false
+	}
+	body, ok := nested["attributes"].(string)
+	return body, ok
+}
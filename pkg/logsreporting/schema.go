@@ -0,0 +1,82 @@
+package logsreporting
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"strings"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// mustCompileSchema compiles an embedded JSON Schema, returning it along with its $id.
+func mustCompileSchema(name string) (*jsonschema.Schema, string) {
+	data, err := schemaFiles.ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		panic(fmt.Sprintf("schema %s: %v", name, err))
+	}
+	id, _ := doc.(map[string]any)["$id"].(string)
+	if id == "" {
+		panic(fmt.Sprintf("schema %s: missing $id", name))
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	if err := compiler.AddResource(id, doc); err != nil {
+		panic(fmt.Sprintf("schema %s: %v", name, err))
+	}
+	return compiler.MustCompile(id), id
+}
+
+// SchemaError is returned for an event that does not match the JSON Schema of
+// its spec_version. It wraps ErrInvalidEvent.
+type SchemaError struct {
+	SpecVersion string
+	// Errors are the validation errors, each prefixed with the JSON pointer of the offending value.
+	Errors []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%v: does not match the schema of spec_version %q: %s", ErrInvalidEvent, e.SpecVersion, strings.Join(e.Errors, "; "))
+}
+
+func (e *SchemaError) Unwrap() error {
+	return ErrInvalidEvent
+}
+
+// ValidateSchema checks the event against the JSON Schema of its spec_version.
+// The event is validated in its AuditLog JSON shape, whatever the wire format
+// it was received in.
+func ValidateSchema(event *AuditLog) error {
+	v, ok := lookupVersion(event.SpecVersion)
+	if !ok {
+		return &SchemaError{SpecVersion: event.SpecVersion, Errors: []string{fmt.Sprintf("/spec_version: unsupported spec_version %q", event.SpecVersion)}}
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	err = v.schema.Validate(doc)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	schemaErr := &SchemaError{SpecVersion: event.SpecVersion}
+	for _, unit := range validationErr.BasicOutput().Errors {
+		if unit.Error != nil {
+			schemaErr.Errors = append(schemaErr.Errors, fmt.Sprintf("%s: %s", unit.InstanceLocation, unit.Error))
+		}
+	}
+	return schemaErr
+}
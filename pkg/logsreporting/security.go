@@ -0,0 +1,78 @@
+package logsreporting
+
+import (
+	"context"
+	"sync"
+)
+
+// Security event types
+const (
+	EventTypeAuthenticationFailed = "security.authentication_failed"
+	EventTypeAccessDenied         = "security.access_denied"
+	EventTypeMalformedRequest     = "security.malformed_request"
+	EventTypePanic                = "security.panic"
+)
+
+// Security reason codes
+const (
+	ReasonMissingCredentials = "missing_credentials"
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonInsufficientScope  = "insufficient_scope"
+	ReasonAccessDenied       = "access_denied"
+	ReasonMalformedPayload   = "malformed_payload"
+	ReasonPanic              = "panic"
+)
+
+type securityFlagKey struct{}
+
+// SecurityFlag collects why a request is suspicious. The security middleware
+// places it in the request context, the layers that reject the request flag
+// it, and the middleware reports it once the response is sent.
+//
+// All methods are safe to call on a nil SecurityFlag.
+type SecurityFlag struct {
+	mu     sync.Mutex
+	reason string
+	detail string
+	actor  Actor
+}
+
+// ContextWithSecurityFlag returns a copy of ctx carrying the flag.
+func ContextWithSecurityFlag(ctx context.Context, flag *SecurityFlag) context.Context {
+	return context.WithValue(ctx, securityFlagKey{}, flag)
+}
+
+// SecurityFlagFromContext returns the flag of the current request, nil when it is not monitored.
+func SecurityFlagFromContext(ctx context.Context) *SecurityFlag {
+	flag, _ := ctx.Value(securityFlagKey{}).(*SecurityFlag)
+	return flag
+}
+
+// FlagSecurity flags the request of ctx with a reason code and a detail. actor
+// describes the caller when it is known, and is the zero Actor otherwise.
+func FlagSecurity(ctx context.Context, reason, detail string, actor Actor) {
+	SecurityFlagFromContext(ctx).Flag(reason, detail, actor)
+}
+
+// Flag records the reason, the last one wins.
+func (f *SecurityFlag) Flag(reason, detail string, actor Actor) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reason, f.detail = reason, detail
+	if actor.Known() {
+		f.actor = actor
+	}
+}
+
+// Reason returns the reason code, detail and actor flagged, if any.
+func (f *SecurityFlag) Reason() (reason, detail string, actor Actor) {
+	if f == nil {
+		return "", "", Actor{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reason, f.detail, f.actor
+}
@@ -0,0 +1,115 @@
+package logsreporting
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultSubjectTemplate is the template of the NATS subjects the events are published on.
+const DefaultSubjectTemplate = "audit.{tenant}.{resource_type}.{action}"
+
+// LegacySubject is the flat subject every event was published on before the
+// subjects were built from the events.
+const LegacySubject = "audit_logs"
+
+// subjectPlaceholders are the values of an event a subject template can use.
+var subjectPlaceholders = map[string]func(event *AuditLog) string{
+	"{tenant}":        func(event *AuditLog) string { return event.Actor.Tenant },
+	"{actor_type}":    func(event *AuditLog) string { return event.Actor.Type },
+	"{resource_type}": func(event *AuditLog) string { return event.Resource.Type },
+	"{type}":          func(event *AuditLog) string { return event.Type },
+	"{source}":        func(event *AuditLog) string { return event.Source },
+}
+
+// placeholderAction spans as many tokens as the action has dot-separated
+// segments, e.g. audit.acme.account.account.update, so that a subscriber can
+// pick the actions of a group (security.>). It can only be the last token.
+const placeholderAction = "{action}"
+
+// SubjectTemplate builds the NATS subject of an event from dot-separated
+// tokens, each either a literal or a placeholder: {tenant}, {actor_type},
+// {resource_type}, {type}, {source} and, as the last token, {action}.
+type SubjectTemplate struct {
+	tokens []string
+}
+
+// ParseSubjectTemplate reads a template such as DefaultSubjectTemplate.
+func ParseSubjectTemplate(template string) (SubjectTemplate, error) {
+	tokens := strings.Split(template, ".")
+	for i, token := range tokens {
+		switch {
+		case token == placeholderAction:
+			if i != len(tokens)-1 {
+				return SubjectTemplate{}, fmt.Errorf("subject template %q: %s must be the last token", template, placeholderAction)
+			}
+		case strings.HasPrefix(token, "{"):
+			if _, ok := subjectPlaceholders[token]; !ok {
+				return SubjectTemplate{}, fmt.Errorf("subject template %q: unknown placeholder %s", template, token)
+			}
+		case token == "" || strings.ContainsAny(token, "*> \t{}"):
+			return SubjectTemplate{}, fmt.Errorf("subject template %q: invalid token %q", template, token)
+		}
+	}
+	return SubjectTemplate{tokens: tokens}, nil
+}
+
+// MustParseSubjectTemplate is ParseSubjectTemplate for templates known to be valid.
+func MustParseSubjectTemplate(template string) SubjectTemplate {
+	t, err := ParseSubjectTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Subject returns the subject of the event. The values are sanitized into
+// tokens: dots and wildcards become underscores, and an empty value is "_".
+func (t SubjectTemplate) Subject(event *AuditLog) string {
+	tokens := make([]string, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		switch value, ok := subjectPlaceholders[token]; {
+		case ok:
+			tokens = append(tokens, subjectToken(value(event)))
+		case token == placeholderAction:
+			for _, segment := range strings.Split(event.Action, ".") {
+				tokens = append(tokens, subjectToken(segment))
+			}
+		default:
+			tokens = append(tokens, token)
+		}
+	}
+	return strings.Join(tokens, ".")
+}
+
+// Wildcard returns the subject matching every subject of the template.
+func (t SubjectTemplate) Wildcard() string {
+	tokens := make([]string, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		switch _, ok := subjectPlaceholders[token]; {
+		case ok:
+			tokens = append(tokens, "*")
+		case token == placeholderAction:
+			tokens = append(tokens, ">")
+		default:
+			tokens = append(tokens, token)
+		}
+	}
+	return strings.Join(tokens, ".")
+}
+
+func (t SubjectTemplate) String() string {
+	return strings.Join(t.tokens, ".")
+}
+
+func subjectToken(value string) string {
+	if value == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
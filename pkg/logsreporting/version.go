@@ -0,0 +1,146 @@
+package logsreporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Upcaster rewrites the AuditLog JSON document of an event of one spec_version
+// into the shape of the next one. It does not need to set the spec_version.
+type Upcaster func(doc map[string]any) error
+
+// version is a spec_version of the events.
+type version struct {
+	specVersion string
+	schema      *jsonschema.Schema
+	// schemaID is the $id of the schema, the dataschema of the CloudEvents.
+	schemaID string
+	// upcast rewrites an event into the next version, nil for the current one.
+	upcast Upcaster
+}
+
+// versions are the spec_versions from the oldest to the current one, SpecVersion.
+// A new version is added at the end, along with its schema, and the upcaster
+// from the previous version; events are never downcast.
+var versions = []version{
+	newVersion("1.0", "schemas/audit_log.1.0.json", upcastFirstVersion),
+	newVersion("1.1", "schemas/audit_log.1.1.json", nil),
+}
+
+func newVersion(specVersion, schemaFile string, upcast Upcaster) version {
+	schema, id := mustCompileSchema(schemaFile)
+	return version{specVersion: specVersion, schema: schema, schemaID: id, upcast: upcast}
+}
+
+// versionIndex returns the index of specVersion in versions, -1 when unknown.
+func versionIndex(specVersion string) int {
+	for i, v := range versions {
+		if v.specVersion == specVersion {
+			return i
+		}
+	}
+	return -1
+}
+
+func lookupVersion(specVersion string) (version, bool) {
+	if i := versionIndex(specVersion); i >= 0 {
+		return versions[i], true
+	}
+	return version{}, false
+}
+
+// specVersionOfSchema returns the spec_version whose schema has the $id schemaID.
+func specVersionOfSchema(schemaID string) (string, bool) {
+	for _, v := range versions {
+		if v.schemaID == schemaID {
+			return v.specVersion, true
+		}
+	}
+	return "", false
+}
+
+// schemaIDOf returns the $id of the schema of specVersion, empty when unknown.
+func schemaIDOf(specVersion string) string {
+	v, _ := lookupVersion(specVersion)
+	return v.schemaID
+}
+
+// Upcast reads the AuditLog JSON document of an event of any known spec_version,
+// as published or stored, rewriting it into the current version.
+func Upcast(data []byte) (*AuditLog, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	specVersion, _ := doc["spec_version"].(string)
+	i := versionIndex(specVersion)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: unsupported spec_version %q", ErrInvalidEvent, specVersion)
+	}
+	for ; versions[i].upcast != nil; i++ {
+		if err := versions[i].upcast(doc); err != nil {
+			return nil, fmt.Errorf("upcasting from spec_version %s: %w", versions[i].specVersion, err)
+		}
+		doc["spec_version"] = versions[i+1].specVersion
+	}
+
+	upcast, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var event AuditLog
+	if err := json.Unmarshal(upcast, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// UpcastEvent rewrites an event of an older spec_version into the current one.
+// An event of the current version is returned as it is.
+func UpcastEvent(event *AuditLog) (*AuditLog, error) {
+	if event.SpecVersion == SpecVersion {
+		return event, nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return Upcast(data)
+}
+
+// upcastFirstVersion is the upcaster from 1.0 to 1.1, which requires the type
+// of the actor and the structured shape of the resource.
+func upcastFirstVersion(doc map[string]any) error {
+	upcastUntypedActor(doc)
+	return upcastLegacyResource(doc)
+}
+
+// upcastUntypedActor types the actors of the first producers, which only set
+// their id as they assumed every request to be made by an authenticated user.
+func upcastUntypedActor(doc map[string]any) {
+	actor, ok := doc["actor"].(map[string]any)
+	if !ok {
+		return
+	}
+	if actorType, _ := actor["type"].(string); actorType == "" {
+		actor["type"] = "user"
+	}
+}
+
+// upcastLegacyResource rewrites a resource of the legacy shape (see
+// Resource.Upgrade) into the structured one.
+func upcastLegacyResource(doc map[string]any) error {
+	data, err := json.Marshal(doc["resource"])
+	if err != nil {
+		return err
+	}
+	var resource Resource
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return err
+	}
+	if resource.Upgrade() {
+		doc["resource"] = resource
+	}
+	return nil
+}
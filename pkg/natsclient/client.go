@@ -22,3 +22,14 @@ func New(url string) (*nats.Conn, error) {
 	log.Info().Msg("connected to nats")
 	return nc, err
 }
+
+// OnReconnect runs fn, after the handlers already set, every time the connection is re-established.
+func OnReconnect(nc *nats.Conn, fn func()) {
+	previous := nc.ReconnectHandler()
+	nc.SetReconnectHandler(func(nc *nats.Conn) {
+		if previous != nil {
+			previous(nc)
+		}
+		fn()
+	})
+}
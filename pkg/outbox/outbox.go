@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+)
+
+// DB begins the transactions of the outbox, typically a *pgxpool.Pool.
+type DB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Insert stores an audit event in the outbox as part of tx, so the event is
+// committed if and only if the change it describes is.
+func Insert(ctx context.Context, tx pgx.Tx, event *logsreporting.AuditLog) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO audit_outbox (event_id, payload) VALUES ($1, $2)`, event.ID, payload)
+	return err
+}
+
+// WithinTx runs fn in a transaction and records the audit draft of ctx, if
+// any, in the outbox within that same transaction, failing with
+// logsreporting.ErrAuditUnavailable when it cannot be. A draft whose request is not
+// audited is still marked recorded, so that it is not published either.
+func WithinTx(ctx context.Context, db DB, fn func(tx pgx.Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	draft := logsreporting.DraftFromContext(ctx)
+	if event := draft.Event(nil); event != nil {
+		if err := Insert(ctx, tx, event); err != nil {
+			return fmt.Errorf("%w: %v", logsreporting.ErrAuditUnavailable, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	draft.MarkRecorded()
+	return nil
+}
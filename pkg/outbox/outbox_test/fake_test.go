@@ -0,0 +1,82 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeTx records the statements executed in a transaction and how it ended.
+// Only the methods used by the outbox are implemented.
+type fakeTx struct {
+	pgx.Tx
+	execs      []exec
+	execErr    error
+	rows       [][]any
+	committed  bool
+	rolledBack bool
+}
+
+type exec struct {
+	sql  string
+	args []any
+}
+
+func (tx *fakeTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if tx.execErr != nil {
+		return pgconn.CommandTag{}, tx.execErr
+	}
+	tx.execs = append(tx.execs, exec{sql: sql, args: args})
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *fakeTx) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return &fakeRows{rows: tx.rows}, nil
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+	return nil
+}
+
+type fakeDB struct {
+	tx *fakeTx
+}
+
+func (db *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	return db.tx, nil
+}
+
+// fakeRows returns the (id, payload) rows of the outbox.
+type fakeRows struct {
+	pgx.Rows
+	rows [][]any
+	next int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	row := r.rows[r.next-1]
+	if len(dest) != len(row) {
+		return errors.New("unexpected column count")
+	}
+	*dest[0].(*int64) = row[0].(int64)
+	*dest[1].(*[]byte) = row[1].([]byte)
+	return nil
+}
+
+func (r *fakeRows) Close() {}
+
+func (r *fakeRows) Err() error { return nil }
@@ -0,0 +1,108 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func draftContext(audited bool) (context.Context, *logsreporting.Draft) {
+	draft := logsreporting.NewDraft("42", func(resourceID, action string, changes []logsreporting.Change, reqCtx logsreporting.Context) *logsreporting.AuditLog {
+		if !audited {
+			return nil
+		}
+		return &logsreporting.AuditLog{
+			ID:          "11111111-1111-1111-1111-111111111111",
+			SpecVersion: logsreporting.SpecVersion,
+			Type:        logsreporting.EventTypeChange,
+			Action:      "update",
+			Resource:    logsreporting.Resource{ID: resourceID, Type: "account"},
+		}
+	})
+	return logsreporting.ContextWithDraft(context.Background(), draft), draft
+}
+
+func TestWithinTx(t *testing.T) {
+	errChange := errors.New("change failed")
+	tests := map[string]struct {
+		audited      bool
+		fnErr        error
+		insertErr    error
+		wantErr      error
+		wantExecs    []string
+		wantCommit   bool
+		wantRecorded bool
+	}{
+		"commits the change along with the event": {
+			audited:      true,
+			wantExecs:    []string{"UPDATE accounts SET", "INSERT INTO audit_outbox"},
+			wantCommit:   true,
+			wantRecorded: true,
+		},
+		"rolls back a failed change without recording the event": {
+			audited:   true,
+			fnErr:     errChange,
+			wantErr:   errChange,
+			wantExecs: []string{"UPDATE accounts SET"},
+		},
+		"rolls back the change when the event cannot be stored": {
+			audited:   true,
+			insertErr: errors.New("audit_outbox does not exist"),
+			wantErr:   logsreporting.ErrAuditUnavailable,
+			wantExecs: []string{"UPDATE accounts SET"},
+		},
+		"commits the change of a request that is not audited": {
+			wantExecs:    []string{"UPDATE accounts SET"},
+			wantCommit:   true,
+			wantRecorded: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, draft := draftContext(tt.audited)
+			tx := &fakeTx{}
+			err := outbox.WithinTx(ctx, &fakeDB{tx: tx}, func(_ pgx.Tx) error {
+				if _, err := tx.Exec(ctx, "UPDATE accounts SET name = $1", "Ada"); err != nil {
+					return err
+				}
+				tx.execErr = tt.insertErr
+				return tt.fnErr
+			})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var statements []string
+			for _, e := range tx.execs {
+				statements = append(statements, strings.Join(strings.Fields(e.sql)[:3], " "))
+			}
+			assert.Equal(t, tt.wantExecs, statements)
+			assert.Equal(t, tt.wantCommit, tx.committed)
+			assert.Equal(t, !tt.wantCommit, tx.rolledBack)
+			assert.Equal(t, tt.wantRecorded, draft.Recorded())
+		})
+	}
+}
+
+func TestWithinTx_InsertsTheDraftEvent(t *testing.T) {
+	ctx, _ := draftContext(true)
+	tx := &fakeTx{}
+	require.NoError(t, outbox.WithinTx(ctx, &fakeDB{tx: tx}, func(pgx.Tx) error { return nil }))
+
+	require.Len(t, tx.execs, 1)
+	assert.Equal(t, "11111111-1111-1111-1111-111111111111", tx.execs[0].args[0])
+	var event logsreporting.AuditLog
+	require.NoError(t, json.Unmarshal(tx.execs[0].args[1].([]byte), &event))
+	assert.Equal(t, "42", event.Resource.ID)
+	assert.Equal(t, "update", event.Action)
+}
@@ -0,0 +1,87 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// failingProducer publishes the events until the one of failAt.
+type failingProducer struct {
+	failAt    string
+	published []string
+}
+
+func (p *failingProducer) PublishSync(_ context.Context, event *logsreporting.AuditLog) error {
+	if event.ID == p.failAt {
+		return errors.New("nats: no responders available for request")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func outboxRow(t *testing.T, id int64, eventID string) []any {
+	payload, err := json.Marshal(&logsreporting.AuditLog{ID: eventID, SpecVersion: logsreporting.SpecVersion})
+	require.NoError(t, err)
+	return []any{id, payload}
+}
+
+func TestRelay_RelayBatch(t *testing.T) {
+	tests := map[string]struct {
+		failAt        string
+		wantSent      int
+		wantErr       bool
+		wantPublished []string
+		wantMarked    []int64
+	}{
+		"marks every published event as sent": {
+			wantSent:      3,
+			wantPublished: []string{"e1", "e2", "e3"},
+			wantMarked:    []int64{1, 2, 3},
+		},
+		"stops at the first publish failure": {
+			failAt:        "e2",
+			wantSent:      1,
+			wantErr:       true,
+			wantPublished: []string{"e1"},
+			wantMarked:    []int64{1},
+		},
+		"marks nothing when the first publish fails": {
+			failAt:  "e1",
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tx := &fakeTx{rows: [][]any{outboxRow(t, 1, "e1"), outboxRow(t, 2, "e2"), outboxRow(t, 3, "e3")}}
+			producer := &failingProducer{failAt: tt.failAt}
+			relay := outbox.NewRelay(&fakeDB{tx: tx}, producer, 10, time.Second)
+
+			sent, err := relay.RelayBatch(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantSent, sent)
+			assert.Equal(t, tt.wantPublished, producer.published)
+			if tt.wantMarked == nil {
+				assert.Empty(t, tx.execs)
+				assert.False(t, tx.committed)
+				return
+			}
+			// the events left unsent stay pending for the next poll
+			require.Len(t, tx.execs, 1)
+			assert.Contains(t, tx.execs[0].sql, "SET sent_at = now()")
+			assert.Equal(t, tt.wantMarked, tx.execs[0].args[0])
+			assert.True(t, tx.committed)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+// publishTimeout bounds the publication of a single event. The outbox rows stay
+// locked while their batch is published, so an unreachable broker must fail fast.
+const publishTimeout = 5 * time.Second
+
+// Relay publishes the events stored in the outbox and marks them as sent.
+// Delivery is at-least-once: an event published right before a crash is
+// published again on restart, consumers must be idempotent on the event id.
+type Relay struct {
+	db           DB
+	producer     logsreporting.SyncProducer
+	batchSize    int
+	pollInterval time.Duration
+}
+
+// NewRelay relays the outbox through producer, which must not retry: a failed
+// batch is simply picked up again on the next poll.
+func NewRelay(db DB, producer logsreporting.SyncProducer, batchSize int, pollInterval time.Duration) *Relay {
+	return &Relay{db: db, producer: producer, batchSize: batchSize, pollInterval: pollInterval}
+}
+
+// Run relays the outbox until ctx is canceled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain the outbox as long as full batches come back
+		for {
+			sent, err := r.RelayBatch(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to relay audit outbox")
+				break
+			}
+			if sent < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("application shutting down, stopping audit outbox relay")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes one batch of pending events and returns how many were
+// sent. Rows are locked with SKIP LOCKED so several instances of the service
+// can relay concurrently.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, payload
+		FROM audit_outbox
+		WHERE sent_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	type pending struct {
+		id    int64
+		event *logsreporting.AuditLog
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		var payload []byte
+		if err := rows.Scan(&p.id, &payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(payload, &p.event); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sentIDs := make([]int64, 0, len(batch))
+	var publishErr error
+	for _, p := range batch {
+		// stop at the first failure to keep the events ordered
+		if publishErr = r.publish(ctx, p.event); publishErr != nil {
+			break
+		}
+		sentIDs = append(sentIDs, p.id)
+	}
+
+	if len(sentIDs) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE audit_outbox SET sent_at = now() WHERE id = ANY($1)`, sentIDs); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, err
+		}
+		log.Debug().Int("count", len(sentIDs)).Msg("audit outbox events relayed")
+	}
+	return len(sentIDs), publishErr
+}
+
+func (r *Relay) publish(ctx context.Context, event *logsreporting.AuditLog) error {
+	publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	return r.producer.PublishSync(publishCtx, event)
+}
@@ -0,0 +1,39 @@
+package redact
+
+import (
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+)
+
+// Event redacts the resource attributes and the field-level changes of an audit
+// event according to the rules of its resource type. It accepts the event as
+// built by the producer as well as decoded from the wire by a consumer, with
+// resources of the structured shape (see logsreporting.Resource.Upgrade).
+func (p *Policy) Event(event *logsreporting.AuditLog) {
+	if event == nil {
+		return
+	}
+	resourceType := event.Resource.Type
+	if len(p.Rules(resourceType)) == 0 {
+		return
+	}
+
+	switch attributes := event.Resource.Attributes.(type) {
+	case nil:
+	case string:
+		// a request body that could not be parsed could hold anything
+		event.Resource.Attributes = nil
+	default:
+		event.Resource.Attributes = p.Document(resourceType, attributes)
+	}
+
+	changes := event.Changes[:0]
+	for _, change := range event.Changes {
+		var keepOld, keepNew bool
+		change.Old, keepOld = p.Field(resourceType, change.Field, change.Old)
+		change.New, keepNew = p.Field(resourceType, change.Field, change.New)
+		if keepOld && keepNew {
+			changes = append(changes, change)
+		}
+	}
+	event.Changes = changes
+}
@@ -0,0 +1,186 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Strategies
+const (
+	StrategyDrop     = "drop"
+	StrategyMask     = "mask"
+	StrategyHash     = "hash"
+	StrategyTruncate = "truncate"
+)
+
+const (
+	hashPrefix = "hmac-sha256:"
+	// MinHMACKeyLength is the shortest key accepted by the "hash" strategy. A
+	// short or well-known key would let hashed values be reversed by dictionary.
+	MinHMACKeyLength    = 32
+	defaultTruncateSize = 8
+	maskChar            = "*"
+)
+
+// Rule redacts the value found at Path, a dotted path into the attributes of a
+// resource where "*" matches every element of an array or object.
+type Rule struct {
+	Path     string `json:"path"`
+	Strategy string `json:"strategy"`
+	// KeepLast is the number of trailing characters left in clear by "mask".
+	KeepLast int `json:"keep_last"`
+	// Length is the number of leading characters kept by "truncate".
+	Length int `json:"length"`
+}
+
+// Policy lists the redaction rules of each resource type.
+//
+// Every strategy is idempotent (a hashed value is recognized by its prefix),
+// so a policy can be applied again downstream without altering redacted data.
+type Policy struct {
+	Resources map[string][]Rule `json:"resources"`
+	hmacKey   []byte
+}
+
+// LoadFile reads a JSON policy. hmacKey is required when a rule uses the "hash"
+// strategy, and must be at least MinHMACKeyLength bytes long.
+func LoadFile(path string, hmacKey []byte) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid redaction policy %s: %w", path, err)
+	}
+	policy.hmacKey = hmacKey
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid redaction policy %s: %w", path, err)
+	}
+	return &policy, nil
+}
+
+func (p *Policy) validate() error {
+	for resourceType, rules := range p.Resources {
+		for _, rule := range rules {
+			if rule.Path == "" {
+				return fmt.Errorf("%s: rule without path", resourceType)
+			}
+			switch rule.Strategy {
+			case StrategyDrop, StrategyMask, StrategyTruncate:
+			case StrategyHash:
+				if len(p.hmacKey) == 0 {
+					return errors.New("a hash rule requires an HMAC key")
+				}
+				if len(p.hmacKey) < MinHMACKeyLength {
+					return fmt.Errorf("a hash rule requires an HMAC key of at least %d bytes", MinHMACKeyLength)
+				}
+			default:
+				return fmt.Errorf("%s.%s: unknown strategy %q", resourceType, rule.Path, rule.Strategy)
+			}
+		}
+	}
+	return nil
+}
+
+// Rules returns the rules of a resource type.
+func (p *Policy) Rules(resourceType string) []Rule {
+	if p == nil {
+		return nil
+	}
+	return p.Resources[resourceType]
+}
+
+// Document redacts a decoded JSON document in place and returns it, since a
+// root that is itself redacted has to be replaced.
+func (p *Policy) Document(resourceType string, doc any) any {
+	for _, rule := range p.Rules(resourceType) {
+		doc = p.apply(doc, strings.Split(rule.Path, "."), rule)
+	}
+	return doc
+}
+
+// Field redacts the value of the top-level field of a resource, as found in a
+// field-level diff. The second result is false when the field must be dropped.
+func (p *Policy) Field(resourceType, field string, value any) (any, bool) {
+	for _, rule := range p.Rules(resourceType) {
+		if rule.Path != field {
+			continue
+		}
+		if rule.Strategy == StrategyDrop {
+			return nil, false
+		}
+		value = p.value(value, rule)
+	}
+	return value, true
+}
+
+func (p *Policy) apply(node any, path []string, rule Rule) any {
+	if len(path) == 0 {
+		return p.value(node, rule)
+	}
+	segment, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		for key, child := range n {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if len(rest) == 0 && rule.Strategy == StrategyDrop {
+				delete(n, key)
+				continue
+			}
+			n[key] = p.apply(child, rest, rule)
+		}
+	case []any:
+		if segment != "*" {
+			return node
+		}
+		for i, child := range n {
+			n[i] = p.apply(child, rest, rule)
+		}
+	}
+	return node
+}
+
+func (p *Policy) value(value any, rule Rule) any {
+	if value == nil {
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		encoded, _ := json.Marshal(value)
+		s = string(encoded)
+	}
+
+	switch rule.Strategy {
+	case StrategyDrop:
+		return nil
+	case StrategyMask:
+		runes := []rune(s)
+		keep := min(max(rule.KeepLast, 0), len(runes))
+		return strings.Repeat(maskChar, len(runes)-keep) + string(runes[len(runes)-keep:])
+	case StrategyTruncate:
+		length := rule.Length
+		if length <= 0 {
+			length = defaultTruncateSize
+		}
+		runes := []rune(s)
+		return string(runes[:min(length, len(runes))])
+	case StrategyHash:
+		if strings.HasPrefix(s, hashPrefix) {
+			return s
+		}
+		mac := hmac.New(sha256.New, p.hmacKey)
+		mac.Write([]byte(s))
+		return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+	}
+	return value
+}
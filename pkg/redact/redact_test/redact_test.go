@@ -0,0 +1,100 @@
+package redact_test
+
+import (
+	"encoding/json"
+	"github.com/ramk42/omi-backend-assignment/pkg/logsreporting"
+	"github.com/ramk42/omi-backend-assignment/pkg/redact"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const policyJSON = `{
+  "resources": {
+    "account": [
+      {"path": "email", "strategy": "hash"},
+      {"path": "name", "strategy": "mask", "keep_last": 2},
+      {"path": "contacts.*.phone", "strategy": "truncate", "length": 3},
+      {"path": "password", "strategy": "drop"}
+    ]
+  }
+}`
+
+var hmacKey = []byte("0123456789abcdef0123456789abcdef")
+
+func loadPolicy(t *testing.T, content string, hmacKey []byte) (*redact.Policy, error) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return redact.LoadFile(path, hmacKey)
+}
+
+func accountEvent() *logsreporting.AuditLog {
+	var attributes any
+	_ = json.Unmarshal([]byte(`{"name":"Jane Doe","email":"jane@example.com","password":"hunter2","contacts":[{"phone":"+33612345678"}]}`), &attributes)
+	return &logsreporting.AuditLog{
+		Resource: logsreporting.Resource{ID: "42", Type: "account", Attributes: attributes},
+		Changes: []logsreporting.Change{
+			{Field: "email", Old: "jane@example.com", New: "doe@example.com"},
+			{Field: "password", Old: "a", New: "b"},
+		},
+	}
+}
+
+func TestPolicy_Event(t *testing.T) {
+	policy, err := loadPolicy(t, policyJSON, hmacKey)
+	require.NoError(t, err)
+
+	event := accountEvent()
+	policy.Event(event)
+
+	encoded, err := json.Marshal(event.Resource.Attributes)
+	require.NoError(t, err)
+	payload := string(encoded)
+	assert.NotContains(t, payload, "jane@example.com")
+	assert.NotContains(t, payload, "hunter2")
+	assert.Contains(t, payload, `"name":"******oe"`)
+	assert.Contains(t, payload, `"phone":"+33"`)
+	assert.Contains(t, payload, `"email":"hmac-sha256:`)
+
+	require.Len(t, event.Changes, 1)
+	assert.True(t, strings.HasPrefix(event.Changes[0].Old.(string), "hmac-sha256:"))
+	assert.NotEqual(t, event.Changes[0].Old, event.Changes[0].New)
+}
+
+func TestPolicy_EventIsIdempotent(t *testing.T) {
+	policy, err := loadPolicy(t, policyJSON, hmacKey)
+	require.NoError(t, err)
+
+	once := accountEvent()
+	policy.Event(once)
+	twice := accountEvent()
+	policy.Event(twice)
+	policy.Event(twice)
+
+	assert.Equal(t, once, twice)
+}
+
+func TestPolicy_DiscardsUnparseablePayload(t *testing.T) {
+	policy, err := loadPolicy(t, policyJSON, hmacKey)
+	require.NoError(t, err)
+
+	event := accountEvent()
+	event.Resource.Attributes = "email=jane@example.com"
+	policy.Event(event)
+
+	assert.Nil(t, event.Resource.Attributes)
+}
+
+func TestLoadFile_Rejects(t *testing.T) {
+	_, err := loadPolicy(t, policyJSON, nil)
+	assert.Error(t, err, "hash rule without key")
+
+	_, err = loadPolicy(t, policyJSON, []byte("change-me"))
+	assert.Error(t, err, "hash rule with a short key")
+
+	_, err = loadPolicy(t, `{"resources":{"account":[{"path":"email","strategy":"rot13"}]}}`, nil)
+	assert.Error(t, err, "unknown strategy")
+}
@@ -0,0 +1,196 @@
+package spool_test
+
+import (
+	"github.com/ramk42/omi-backend-assignment/pkg/spool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T, dir string, segmentSize int64) *spool.WAL {
+	wal, err := spool.Open(dir, spool.Options{Sync: spool.SyncAlways, SegmentSize: segmentSize})
+	require.NoError(t, err)
+	return wal
+}
+
+func pending(t *testing.T, wal *spool.WAL) []string {
+	var payloads []string
+	require.NoError(t, wal.Pending(func(_ uint64, payload []byte) bool {
+		payloads = append(payloads, string(payload))
+		return true
+	}))
+	return payloads
+}
+
+func segments(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+	return matches
+}
+
+func TestWAL_ReplaysUnacknowledgedRecordsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	wal := open(t, dir, 0)
+	for i := 1; i <= 4; i++ {
+		seq, err := wal.Append([]byte("event-" + strconv.Itoa(i)))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i), seq)
+	}
+	require.NoError(t, wal.Ack(1))
+	require.NoError(t, wal.Ack(3))
+	assert.Equal(t, []string{"event-2", "event-4"}, pending(t, wal))
+	require.NoError(t, wal.Close())
+
+	// only the contiguous acknowledgments survive a restart
+	wal = open(t, dir, 0)
+	defer wal.Close()
+	assert.Equal(t, []string{"event-2", "event-3", "event-4"}, pending(t, wal))
+
+	seq, err := wal.Append([]byte("event-5"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), seq)
+}
+
+func TestWAL_CompactsAcknowledgedSegments(t *testing.T) {
+	dir := t.TempDir()
+	// every record gets a segment of its own
+	wal := open(t, dir, 1)
+	defer wal.Close()
+	for i := 1; i <= 3; i++ {
+		_, err := wal.Append([]byte("event-" + strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+	require.Len(t, segments(t, dir), 3)
+
+	require.NoError(t, wal.Ack(2))
+	assert.Len(t, segments(t, dir), 3, "record 1 is still pending")
+	require.NoError(t, wal.Ack(1))
+	assert.Len(t, segments(t, dir), 1)
+	assert.Equal(t, []string{"event-3"}, pending(t, wal))
+}
+
+func TestWAL_TruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	wal := open(t, dir, 0)
+	_, err := wal.Append([]byte("event-1"))
+	require.NoError(t, err)
+	_, err = wal.Append([]byte("event-2"))
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	// a crash in the middle of the second append
+	segment := segments(t, dir)[0]
+	info, err := os.Stat(segment)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(segment, info.Size()-3))
+
+	wal = open(t, dir, 0)
+	defer wal.Close()
+	assert.Equal(t, []string{"event-1"}, pending(t, wal))
+	seq, err := wal.Append([]byte("event-3"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), seq)
+	assert.Equal(t, []string{"event-1", "event-3"}, pending(t, wal))
+}
+
+func TestWAL_StopsAtChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	wal := open(t, dir, 0)
+	_, err := wal.Append([]byte("event-1"))
+	require.NoError(t, err)
+	_, err = wal.Append([]byte("event-2"))
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	segment := segments(t, dir)[0]
+	data, err := os.ReadFile(segment)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(segment, data, 0o600))
+
+	wal = open(t, dir, 0)
+	defer wal.Close()
+	assert.Equal(t, []string{"event-1"}, pending(t, wal))
+}
+
+func TestWAL_SkipsUnreadableRecordsOfSealedSegment(t *testing.T) {
+	dir := t.TempDir()
+	// three records per segment
+	wal := open(t, dir, 3*int64(16+len("event-1")))
+	for i := 1; i <= 7; i++ {
+		_, err := wal.Append([]byte("event-" + strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, wal.Close())
+	require.Len(t, segments(t, dir), 3)
+
+	// corrupt the middle record of the first segment
+	first := segments(t, dir)[0]
+	data, err := os.ReadFile(first)
+	require.NoError(t, err)
+	data[(16+len("event-1"))+16] ^= 0xff
+	require.NoError(t, os.WriteFile(first, data, 0o600))
+
+	wal = open(t, dir, 3*int64(16+len("event-1")))
+	defer wal.Close()
+	// event-3 follows the corrupt record in its segment and cannot be read either
+	assert.Equal(t, []string{"event-1", "event-4", "event-5", "event-6", "event-7"}, pending(t, wal))
+	assert.Equal(t, uint64(2), wal.Lost())
+
+	// the checkpoint moves past the lost records and the first segments are compacted
+	for _, seq := range []uint64{1, 4, 5, 6} {
+		require.NoError(t, wal.Ack(seq))
+	}
+	assert.Len(t, segments(t, dir), 1)
+	assert.Equal(t, []string{"event-7"}, pending(t, wal))
+}
+
+func TestWAL_AppendsDuringPending(t *testing.T) {
+	wal := open(t, t.TempDir(), 0)
+	defer wal.Close()
+	for i := 1; i <= 2; i++ {
+		_, err := wal.Append([]byte("event-" + strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+
+	var seen []string
+	require.NoError(t, wal.Pending(func(seq uint64, payload []byte) bool {
+		seen = append(seen, string(payload))
+		_, err := wal.Append([]byte("appended-" + strconv.FormatUint(seq, 10)))
+		require.NoError(t, err)
+		require.NoError(t, wal.Ack(seq))
+		return true
+	}))
+	assert.Equal(t, []string{"event-1", "event-2"}, seen)
+	assert.Equal(t, []string{"appended-1", "appended-2"}, pending(t, wal))
+}
+
+func TestWAL_CheckpointsOnSyncInterval(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := spool.Open(dir, spool.Options{Sync: spool.SyncInterval, SyncInterval: 300 * time.Millisecond, SegmentSize: 1})
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		_, err := wal.Append([]byte("event-" + strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, wal.Ack(1))
+	require.NoError(t, wal.Ack(2))
+
+	// the acknowledgments are written and the segments compacted on the next tick, not on every ack
+	assert.NoFileExists(t, filepath.Join(dir, "checkpoint"))
+	assert.Len(t, segments(t, dir), 3)
+	require.Eventually(t, func() bool { return len(segments(t, dir)) == 1 }, 3*time.Second, 10*time.Millisecond)
+	checkpoint, err := os.ReadFile(filepath.Join(dir, "checkpoint"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(checkpoint))
+
+	require.NoError(t, wal.Ack(3))
+	require.NoError(t, wal.Close())
+	checkpoint, err = os.ReadFile(filepath.Join(dir, "checkpoint"))
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(checkpoint), "the checkpoint is written on close")
+}
@@ -0,0 +1,549 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fsync policies
+const (
+	// SyncAlways flushes every append to disk before it returns.
+	SyncAlways = "always"
+	// SyncInterval flushes in the background every SyncInterval.
+	SyncInterval = "interval"
+	// SyncNone leaves flushing to the operating system.
+	SyncNone = "none"
+)
+
+const (
+	segmentExt     = ".seg"
+	checkpointName = "checkpoint"
+	// a record is its sequence number, payload length and checksum, then the payload
+	headerSize         = 16
+	maxRecordSize      = 16 << 20
+	defaultSegmentSize = 16 << 20
+	// checkpointInterval is how often the checkpoint is written when no sync interval is set.
+	checkpointInterval = time.Second
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var ErrClosed = errors.New("spool closed")
+
+type Options struct {
+	Sync         string
+	SyncInterval time.Duration
+	// SegmentSize is the size past which a new segment file is started.
+	SegmentSize int64
+}
+
+// WAL is an append-only log of records split in segment files named after the
+// sequence number of their first record. Records are acknowledged once handled:
+// the highest sequence number below which all records are acknowledged is
+// checkpointed, and the segments it covers entirely are removed.
+//
+// Acknowledgments above the checkpoint are kept in memory only, so their
+// records are handed out again after a restart (at-least-once). The checkpoint
+// itself is written on every acknowledgment with the always sync policy only;
+// otherwise it is written, and the segments compacted, in the background every
+// sync interval (every second with the none policy) and on Close.
+//
+// The records of a segment that follow an unreadable one can never be handed
+// out. They are counted as lost and acknowledged, so that the checkpoint keeps
+// advancing and the spool does not grow without bound.
+type WAL struct {
+	mu       sync.Mutex
+	dir      string
+	opts     Options
+	segments []uint64 // first sequence number of each segment, in order
+	active   *os.File
+	size     int64
+	nextSeq  uint64
+	acked    uint64 // checkpoint
+	ackedSet map[uint64]struct{}
+	// checkpointed is the checkpoint last written to disk
+	checkpointed uint64
+	lost         uint64
+	dirty        bool
+	closed       bool
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// Open opens the spool of dir, creating it if needed. A torn record at the end
+// of the last segment, left by a crash in the middle of an append, is truncated.
+func Open(dir string, opts Options) (*WAL, error) {
+	switch opts.Sync {
+	case SyncAlways, SyncNone:
+	case SyncInterval:
+		if opts.SyncInterval <= 0 {
+			return nil, errors.New("the interval sync policy requires a positive interval")
+		}
+	default:
+		return nil, fmt.Errorf("unknown sync policy %q", opts.Sync)
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	w := &WAL{dir: dir, opts: opts, ackedSet: map[uint64]struct{}{}, stop: make(chan struct{}), done: make(chan struct{})}
+	var err error
+	if w.acked, err = w.readCheckpoint(); err != nil {
+		return nil, err
+	}
+	w.checkpointed = w.acked
+	if w.segments, err = w.listSegments(); err != nil {
+		return nil, err
+	}
+	w.nextSeq = w.acked + 1
+	if len(w.segments) > 0 {
+		if err := w.recoverLastSegment(); err != nil {
+			return nil, err
+		}
+	} else if err := w.rotate(); err != nil {
+		return nil, err
+	}
+
+	switch opts.Sync {
+	case SyncInterval:
+		go w.syncLoop(opts.SyncInterval)
+	case SyncNone:
+		go w.syncLoop(checkpointInterval)
+	default:
+		close(w.done)
+	}
+	return w, nil
+}
+
+// Append writes payload to the log and returns its sequence number.
+func (w *WAL) Append(payload []byte) (uint64, error) {
+	if len(payload) > maxRecordSize {
+		return 0, fmt.Errorf("record of %d bytes exceeds the maximum of %d", len(payload), maxRecordSize)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.size >= w.opts.SegmentSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	seq := w.nextSeq
+	record := encodeRecord(seq, payload)
+	n, err := w.active.Write(record)
+	w.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	if w.opts.Sync == SyncAlways {
+		if err := w.active.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	w.nextSeq++
+	w.dirty = true
+	return seq, nil
+}
+
+// Ack marks a record as handled.
+func (w *WAL) Ack(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if seq <= w.acked {
+		return nil
+	}
+	w.ackedSet[seq] = struct{}{}
+	return w.advance()
+}
+
+// advance moves the checkpoint past the contiguous acknowledgments. It is
+// written right away with the always sync policy only.
+func (w *WAL) advance() error {
+	advanced := false
+	for {
+		if _, ok := w.ackedSet[w.acked+1]; !ok {
+			break
+		}
+		delete(w.ackedSet, w.acked+1)
+		w.acked++
+		advanced = true
+	}
+	if !advanced || w.opts.Sync != SyncAlways {
+		return nil
+	}
+	return w.flushCheckpoint()
+}
+
+// flushCheckpoint writes the checkpoint if it moved since it was last written, then compacts.
+func (w *WAL) flushCheckpoint() error {
+	if w.acked == w.checkpointed {
+		return nil
+	}
+	if err := w.writeCheckpoint(); err != nil {
+		return err
+	}
+	w.checkpointed = w.acked
+	return w.compact()
+}
+
+// Lost returns the number of records skipped because they could not be read back.
+func (w *WAL) Lost() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lost
+}
+
+// Pending calls fn on every record not acknowledged yet, in order, until fn
+// returns false.
+//
+// The segments are read without holding the lock, from a snapshot of the
+// acknowledgments and of the size of the active segment, so that appends are
+// not held by the scan and fn may call the WAL. Records acknowledged during
+// the scan may still be handed out, records appended during it are not.
+func (w *WAL) Pending(fn func(seq uint64, payload []byte) bool) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	segments := slices.Clone(w.segments)
+	activeSize := w.size
+	acked := w.acked
+	ackedSet := make(map[uint64]struct{}, len(w.ackedSet))
+	for seq := range w.ackedSet {
+		ackedSet[seq] = struct{}{}
+	}
+	w.mu.Unlock()
+
+	for i, first := range segments {
+		sealed := i < len(segments)-1
+		limit := int64(-1)
+		if !sealed {
+			// the records appended after the snapshot may still be partially written
+			limit = activeSize
+		}
+		keepGoing := true
+		next := first
+		_, corrupt, err := w.readSegment(first, limit, func(seq uint64, payload []byte) bool {
+			next = seq + 1
+			if seq <= acked {
+				return true
+			}
+			if _, ok := ackedSet[seq]; ok {
+				return true
+			}
+			keepGoing = fn(seq, payload)
+			return keepGoing
+		})
+		// all its records were acknowledged and it was compacted since the snapshot
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// the tail of the active segment is still being written, only sealed segments are skipped
+		if corrupt && sealed {
+			if err := w.skip(first, next, segments[i+1]); err != nil {
+				return err
+			}
+		}
+		if !keepGoing {
+			return nil
+		}
+	}
+	return nil
+}
+
+// skip acknowledges the records from up to end, excluded, of the segment
+// starting at first, which cannot be read past from.
+func (w *WAL) skip(first, from, end uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	var lost uint64
+	for seq := max(from, w.acked+1); seq < end; seq++ {
+		if _, ok := w.ackedSet[seq]; ok {
+			continue
+		}
+		w.ackedSet[seq] = struct{}{}
+		lost++
+	}
+	if lost == 0 {
+		return nil
+	}
+	w.lost += lost
+	log.Error().Str("segment", w.segmentPath(first)).Uint64("from", from).Uint64("to", end-1).Uint64("lost", lost).
+		Msg("skipping unreadable records of audit spool")
+	return w.advance()
+}
+
+// Close flushes and closes the log.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stop)
+	w.mu.Unlock()
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	checkpointErr := w.flushCheckpoint()
+	if err := w.active.Sync(); err != nil {
+		w.active.Close()
+		return err
+	}
+	if err := w.active.Close(); err != nil {
+		return err
+	}
+	return checkpointErr
+}
+
+// syncLoop flushes the active segment, with the interval sync policy, and
+// writes the checkpoint every interval.
+func (w *WAL) syncLoop(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		if w.dirty && w.opts.Sync == SyncInterval {
+			if err := w.active.Sync(); err != nil {
+				log.Error().Err(err).Msg("failed to sync audit spool")
+			}
+			w.dirty = false
+		}
+		if err := w.flushCheckpoint(); err != nil {
+			log.Error().Err(err).Msg("failed to checkpoint audit spool")
+		}
+		w.mu.Unlock()
+	}
+}
+
+// rotate starts a new segment with the next sequence number.
+func (w *WAL) rotate() error {
+	if w.active != nil {
+		if err := w.active.Sync(); err != nil {
+			return err
+		}
+		if err := w.active.Close(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(w.segmentPath(w.nextSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(w.segments, w.nextSeq) {
+		w.segments = append(w.segments, w.nextSeq)
+	}
+	w.active, w.size = f, 0
+	return syncDir(w.dir)
+}
+
+// compact removes the segments whose records are all acknowledged. The active
+// segment is always kept.
+func (w *WAL) compact() error {
+	for len(w.segments) > 1 && w.segments[1] <= w.acked+1 {
+		if err := os.Remove(w.segmentPath(w.segments[0])); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		w.segments = w.segments[1:]
+	}
+	return nil
+}
+
+func (w *WAL) recoverLastSegment() error {
+	// earlier segments only hold records numbered below the first one of the last segment
+	last := w.segments[len(w.segments)-1]
+	w.nextSeq = max(w.nextSeq, last)
+	validSize, _, err := w.readSegment(last, -1, func(seq uint64, _ []byte) bool {
+		w.nextSeq = max(w.nextSeq, seq+1)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(w.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if info.Size() > validSize {
+		log.Warn().Int64("bytes", info.Size()-validSize).Str("segment", f.Name()).Msg("truncating torn tail of audit spool")
+		if err := f.Truncate(validSize); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	w.active, w.size = f, validSize
+	return nil
+}
+
+// readSegment calls fn on the records of the first limit bytes of a segment
+// (all of them when limit is negative) until fn returns false and returns the
+// size of its valid prefix. Reading stops at the first record that is
+// incomplete or fails its checksum, which is reported as corrupt.
+func (w *WAL) readSegment(first uint64, limit int64, fn func(seq uint64, payload []byte) bool) (int64, bool, error) {
+	f, err := os.Open(w.segmentPath(first))
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	reader := bufio.NewReader(r)
+	var offset int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Warn().Str("segment", f.Name()).Int64("offset", offset).Msg("incomplete record header in audit spool")
+				return offset, true, nil
+			}
+			return offset, false, nil
+		}
+		seq := binary.BigEndian.Uint64(header[0:8])
+		length := binary.BigEndian.Uint32(header[8:12])
+		checksum := binary.BigEndian.Uint32(header[12:16])
+		if length > maxRecordSize {
+			log.Warn().Str("segment", f.Name()).Int64("offset", offset).Msg("invalid record length in audit spool")
+			return offset, true, nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			log.Warn().Str("segment", f.Name()).Int64("offset", offset).Msg("incomplete record in audit spool")
+			return offset, true, nil
+		}
+		if recordChecksum(header[:12], payload) != checksum {
+			log.Warn().Str("segment", f.Name()).Int64("offset", offset).Msg("checksum mismatch in audit spool")
+			return offset, true, nil
+		}
+		offset += headerSize + int64(length)
+		if !fn(seq, payload) {
+			return offset, false, nil
+		}
+	}
+}
+
+func (w *WAL) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		first, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, first)
+	}
+	slices.Sort(segments)
+	return segments, nil
+}
+
+func (w *WAL) segmentPath(first uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", first, segmentExt))
+}
+
+func (w *WAL) readCheckpoint() (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(w.dir, checkpointName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// writeCheckpoint replaces the checkpoint atomically.
+func (w *WAL) writeCheckpoint() error {
+	tmp := filepath.Join(w.dir, checkpointName+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strconv.FormatUint(w.acked, 10)); err != nil {
+		f.Close()
+		return err
+	}
+	if w.opts.Sync == SyncAlways {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(w.dir, checkpointName))
+}
+
+func encodeRecord(seq uint64, payload []byte) []byte {
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint64(record[0:8], seq)
+	binary.BigEndian.PutUint32(record[8:12], uint32(len(payload)))
+	copy(record[headerSize:], payload)
+	binary.BigEndian.PutUint32(record[12:16], recordChecksum(record[:12], payload))
+	return record
+}
+
+func recordChecksum(header, payload []byte) uint32 {
+	checksum := crc32.Update(0, castagnoli, header)
+	return crc32.Update(checksum, castagnoli, payload)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}